@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+func buildCacheCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "cache",
+		Short: "Sub-Commands for managing the cache of compiled PHP extensions",
+	}
+
+	command.AddCommand(buildCacheListCommand())
+	command.AddCommand(buildCacheClearCommand())
+
+	return command
+}
+
+func buildCacheListCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "list",
+		Short: "List the cached PHP extensions",
+		Long: color.Sprintf(`Usage:	drydock cache list
+
+List the compiled PHP extensions (xdebug, excimer, spx) in the extension cache. An extension is built once per
+PHP build (PHP version, PHP API, ZTS/NTS, architecture and libc); afterwards, it is copied into the container
+instead of being compiled again.
+`),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, err := util.DefaultExtensionCache()
+			if err != nil {
+				return err
+			}
+			entries, err := cache.List()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				color.Printf("<gray># the extension cache %s is empty</>\n", cache.Dir)
+				return nil
+			}
+
+			color.Printf("<gray># %s</>\n", cache.Dir)
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "EXTENSION\tVERSION\tBUILD\tSIZE\tCACHED")
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%.1f MB\t%s\n", entry.Extension, entry.Version, entry.BuildKey, float64(entry.Size)/(1024*1024), entry.ModTime.Format("2006-01-02 15:04"))
+			}
+			return w.Flush()
+		},
+	}
+
+	return command
+}
+
+func buildCacheClearCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "clear [EXTENSION]",
+		Short: "Remove cached PHP extensions, so that they are built again on the next install",
+		Long: color.Sprintf(`Usage:	drydock cache clear [EXTENSION]
+
+Remove all cached builds of the given extension (e.g. <op=italic;>xdebug</>), or the whole extension cache if no
+extension is given. Use this to pick up a newer release of an extension.
+`),
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, err := util.DefaultExtensionCache()
+			if err != nil {
+				return err
+			}
+			extension := ""
+			if len(args) == 1 {
+				extension = args[0]
+			}
+			if err := cache.Clear(extension); err != nil {
+				return err
+			}
+			if extension == "" {
+				color.Printf("<green>Cleared the extension cache %s</>\n", cache.Dir)
+			} else {
+				color.Printf("<green>Removed the cached builds of %s</>\n", extension)
+			}
+			return nil
+		},
+	}
+
+	return command
+}
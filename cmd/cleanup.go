@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"os"
+	"slices"
+	"strings"
+)
+
+// drydockArtifact is a file or directory which drydock creates inside a target container.
+type drydockArtifact struct {
+	Description string
+	Path        string
+	// ReloadPhp is true if PHP needs to be reloaded after removing the artifact.
+	ReloadPhp bool
+}
+
+// knownDrydockArtifacts returns everything the drydock PHP commands may have installed into a container with the
+// given environment. The ini files are looked up in the scan dirs found by the PHP probe; without probe result (php is
+// nil), in the conf.d of PHP_INI_DIR.
+func knownDrydockArtifacts(env []string, php *util.PhpRuntime) []drydockArtifact {
+	var artifacts []drydockArtifact
+	for _, tool := range phpToolIniFiles {
+		iniPaths := []string{phpConfDPath(env, tool.IniFile)}
+		if php != nil {
+			iniPaths = php.IniFiles(tool.IniFile)
+		}
+		for _, iniPath := range iniPaths {
+			artifacts = append(artifacts, drydockArtifact{
+				Description: tool.Tool + " ini file",
+				Path:        iniPath,
+				ReloadPhp:   true,
+			})
+		}
+	}
+	artifacts = append(artifacts,
+		drydockArtifact{Description: "spx source checkout", Path: "/php-spx"},
+		drydockArtifact{Description: "excimer prepend file and traces", Path: "/app/tracing"},
+		drydockArtifact{Description: "Xdebug profiles, traces and coverage", Path: xdebugOutputDir},
+	)
+	return artifacts
+}
+
+func buildCleanupCommand() *cobra.Command {
+	var debugImage string = "nicolaka/netshoot"
+	var dryRun bool
+	var force bool
+
+	var command = &cobra.Command{
+		Use:   "cleanup [flags] [SERVICE-or-CONTAINER]",
+		Short: "Revert all changes drydock made to the given container",
+		Long: color.Sprintf(`Usage:	drydock cleanup [flags] [SERVICE-OR-CONTAINER]
+
+Remove everything drydock installed into the given container (ini files, source checkouts, prepend files,
+trace directories), and reload PHP. Running debug and relay sidecar containers are only stopped with --force.
+
+<op=underscore;>Options:</>
+      --dry-run              Only list what would be removed
+      --force                Also stop running debug sidecar containers. They may belong to a live execroot, vscode
+                             or xdebug session in another terminal.
+      --debug-image          What debugger docker image to use for executing nsenter.
+                             By default, nicolaka/netshoot is used
+
+<op=underscore;>Examples</>
+
+<op=bold;>See what drydock left behind in a container</>
+	drydock cleanup --dry-run <op=italic;>myContainer</>
+
+<op=bold;>Remove it</>
+	drydock cleanup <op=italic;>my-docker-compose-service</>
+
+<op=underscore;>Background:</>
+
+    <op=italic;>drydock spx</> never uninstalls itself, and <op=italic;>drydock xdebug</> / <op=italic;>drydock excimer</> only clean up when
+    Ctrl-C is pressed in the same terminal. This command removes all known artifacts after the fact,
+    as well as all files recorded as installed in the drydock journal of the container (see <op=italic;>drydock status</>).
+`),
+		Args: cobra.MaximumNArgs(1),
+
+		Run: func(cmd *cobra.Command, args []string) {
+			target := resolveTargetOrExit(targetIdentifierFromArgsOrPick(args))
+			config := loadConfigOrExit(target)
+			debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
+
+			runtime := runtimeOrExit()
+
+			// the probe finds the ini scan dirs; it also tells how to reload PHP afterwards.
+			php, phpErr := probePhpRuntime(target, debugImage, config)
+			if phpErr != nil {
+				color.Printf("<fg=yellow>Could not detect PHP (%s) - only looking for ini files in PHP_INI_DIR.</>\n", phpErr)
+			}
+
+			var found []drydockArtifact
+			for _, artifact := range knownDrydockArtifacts(target.Env, php) {
+				exists, err := runtime.PathExists(target.ID, artifact.Path)
+				if err != nil {
+					color.Printf("<red>FATAL: Could not check %s in container %s: %s</>\n", artifact.Path, target.Name, err)
+					os.Exit(1)
+				}
+				if exists {
+					found = append(found, artifact)
+				}
+			}
+
+			// everything recorded in the journal which was not removed yet, is cleaned up as well.
+			journalEntries, err := util.ReadJournal(runtime, target.ID)
+			if err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
+				os.Exit(1)
+			}
+			for _, file := range util.ActiveJournalFiles(journalEntries) {
+				if containsArtifactPath(found, file) {
+					continue
+				}
+				exists, err := runtime.PathExists(target.ID, file)
+				if err == nil && exists {
+					found = append(found, drydockArtifact{Description: "recorded in journal", Path: file, ReloadPhp: true})
+				}
+			}
+
+			var runningSidecars []string
+			for _, sidecarName := range []string{target.Name + "_DEBUG", target.Name + xdebugSidecarSuffix} {
+				sidecar, err := runtime.InspectContainer(sidecarName)
+				if err == nil && sidecar.Running {
+					runningSidecars = append(runningSidecars, sidecarName)
+				}
+			}
+
+			if len(found) == 0 && len(runningSidecars) == 0 {
+				color.Printf("<green>Nothing to clean up in </><fg=green;op=bold;>%s</>\n", target.Name)
+				return
+			}
+
+			if dryRun {
+				color.Printf("<green>The following would be removed from </><fg=green;op=bold;>%s</><green>:</>\n", target.Name)
+			} else {
+				color.Printf("<green>Removing from </><fg=green;op=bold;>%s</><green>:</>\n", target.Name)
+			}
+			for _, sidecarName := range runningSidecars {
+				if force {
+					color.Printf("  - debug sidecar container <op=bold;>%s</> (running - a live session is ended)\n", sidecarName)
+				} else {
+					color.Printf("  - <fg=yellow>debug sidecar container </><fg=yellow;op=bold;>%s</><fg=yellow> is running - a live execroot, vscode or xdebug session? Only stopped with --force.</>\n", sidecarName)
+				}
+			}
+			for _, artifact := range found {
+				color.Printf("  - %s <op=bold;>%s</>\n", artifact.Description, artifact.Path)
+			}
+			if dryRun {
+				return
+			}
+
+			if !force {
+				// the debug sidecar uses the same name as our own helper container; so nothing can be removed while it runs.
+				if slices.Contains(runningSidecars, target.Name+"_DEBUG") && len(found) > 0 {
+					color.Printf("<red>FATAL: %s_DEBUG is running - end the session using it, or stop it with --force.</>\n", target.Name)
+					os.Exit(1)
+				}
+				runningSidecars = nil
+				if len(found) == 0 {
+					return
+				}
+			}
+			for _, sidecarName := range runningSidecars {
+				if err := runtime.RemoveContainer(sidecarName, true); err != nil {
+					color.Printf("<red>FATAL: Could not stop debug sidecar %s: %s</>\n", sidecarName, err)
+					os.Exit(1)
+				}
+			}
+
+			if len(found) > 0 {
+				var removedFiles []string
+				for _, artifact := range found {
+					removedFiles = append(removedFiles, artifact.Path)
+				}
+				script := journaledScript(phpCleanupScript(found), newJournalEntry("cleanup", util.JournalActionRemove, "", removedFiles...))
+				if err := runHelperScript(target, debugImage, script); err != nil {
+					color.Printf("<red>FATAL: Cleanup of %s failed: %s</>\n", target.Name, err)
+					os.Exit(1)
+				}
+			}
+
+			if needsPhpReload(found) {
+				if php == nil {
+					// the probe fails while a debug sidecar blocks the name of the helper container; it is gone now.
+					php, phpErr = probePhpRuntime(target, debugImage, config)
+				}
+				if phpErr != nil {
+					color.Printf("<fg=yellow>Not reloading PHP: %s</>\n", phpErr)
+				} else if err := reloadPhp(target, debugImage, php, phpReloadOptionsFromConfig(config)); err != nil {
+					color.Printf("<red>ERROR: %s</>\n", err)
+				}
+			}
+
+			color.Println("<green>=====================================</>")
+			color.Printf("<green>All done!</>\n")
+			color.Println("<green>=====================================</>")
+		},
+	}
+
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "Only list what would be removed")
+	command.Flags().BoolVar(&force, "force", false, "Also stop running debug sidecar containers, even if a live session uses them")
+	command.Flags().StringVarP(&debugImage, "debug-image", "", "nicolaka/netshoot", "What debugger docker image to use for executing nsenter. By default, nicolaka/netshoot is used")
+
+	return command
+}
+
+func containsArtifactPath(artifacts []drydockArtifact, path string) bool {
+	for _, artifact := range artifacts {
+		if artifact.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// phpCleanupScript removes the given artifacts from the container mounted at /container.
+func phpCleanupScript(artifacts []drydockArtifact) string {
+	var script strings.Builder
+	script.WriteString(mountSlashContainer + "\n")
+	for _, artifact := range artifacts {
+		script.WriteString("rm -Rf " + shellQuote("/container"+artifact.Path) + "\n")
+	}
+	return script.String()
+}
+
+// needsPhpReload is true if one of the removed artifacts was loaded by PHP.
+func needsPhpReload(artifacts []drydockArtifact) bool {
+	for _, artifact := range artifacts {
+		if artifact.ReloadPhp {
+			return true
+		}
+	}
+	return false
+}
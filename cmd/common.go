@@ -1,18 +1,127 @@
 package cmd
 
+import (
+	"errors"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
 const mountSlashContainer = "mount -t proc proc /proc; ln -s /proc/1/root /container;"
 
-func dockerRunNsenterCommand(fullContainerName, debugImage, pid string, extraDockerRunArgs []string) []string {
-	result := dockerRunCommand(fullContainerName, debugImage, extraDockerRunArgs)
+// containerRuntime is created on first use by runtimeOrExit, according to the --runtime flag.
+var containerRuntime util.Runtime
+
+// runtimeOrExit returns the container runtime (docker, podman) drydock operates on.
+func runtimeOrExit() util.Runtime {
+	if containerRuntime != nil {
+		return containerRuntime
+	}
+	runtime, err := util.NewRuntime(runtimeName)
+	if err != nil {
+		color.Printf("<red>FATAL: Could not connect to the container runtime: %s</>\n", err)
+		color.Println("")
+		os.Exit(1)
+	}
+	containerRuntime = runtime
+	return runtime
+}
+
+// runtimeExecutableOrExit returns the path of the CLI of the container runtime, used to start helper containers.
+func runtimeExecutableOrExit() string {
+	executable, err := runtimeOrExit().Executable()
+	if err != nil {
+		color.Printf("<red>FATAL: %s</>\n", err)
+		os.Exit(1)
+	}
+	return executable
+}
+
+// resolveTargetOrExit resolves the SERVICE-or-CONTAINER argument of a command; and exits with a consistent error
+// message if the target cannot be used.
+func resolveTargetOrExit(identifier string) *util.Target {
+	if util.IsKubernetesTarget(identifier) {
+		color.Printf("<red>FATAL: Kubernetes pods (</><fg=red;op=bold;>%s</><fg=red>) are only supported by execroot and vscode.</>\n", identifier)
+		color.Println("")
+		os.Exit(1)
+	}
+
+	resolver := util.NewTargetResolver(runtimeOrExit())
+	resolver.Compose = composeOptions
+	resolver.Index = composeIndex
+	if stdinIsTerminal() {
+		resolver.Pick = pickReplica
+	}
+
+	target, err := resolver.Resolve(identifier)
+	if err != nil {
+		var notRunning *util.TargetNotRunningError
+		var notFound *util.TargetNotFoundError
+		var ambiguous *util.TargetAmbiguousError
+		switch {
+		case errors.As(err, &notRunning):
+			color.Printf("<red>FATAL: Container </><fg=red;op=bold;>%s</><fg=red> not running.</>\n", notRunning.Name)
+		case errors.As(err, &notFound):
+			color.Printf("<red>FATAL: Container or docker compose service </><fg=red;op=bold;>%s</><fg=red> not found.</>\n", identifier)
+		case errors.As(err, &ambiguous):
+			color.Printf("<red>FATAL: </><fg=red;op=bold;>%s</><fg=red> matches multiple containers: %s</>\n", identifier, strings.Join(ambiguous.Candidates, ", "))
+			color.Println("<red>Use --index to select a replica.</>")
+		default:
+			color.Printf("<red>FATAL: Could not inspect </><fg=red;op=bold;>%s</><fg=red>: %s</>\n", identifier, err)
+		}
+		color.Println("")
+		os.Exit(1)
+	}
+
+	if target.MatchedComposeService {
+		color.Printf("<green>docker compose service </><fg=green;op=bold;>%s</><fg=green> found, entering it.</>\n", identifier)
+		color.Println("")
+	}
+	return target
+}
+
+// runHelperScript runs the given bash script in the debug image, entered into the target container (like
+// execroot --no-chroot). The target's environment is passed through, and the output is shown to the user.
+func runHelperScript(target *util.Target, debugImage string, script string) error {
+	c := helperScriptCommand(target, debugImage, script)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// helperScriptCommand is the command behind runHelperScript; for scripts which stream data through stdin or stdout.
+// extraDockerRunArgs are passed to "docker run" (e.g. "-i" to attach stdin).
+func helperScriptCommand(target *util.Target, debugImage string, script string, extraDockerRunArgs ...string) *exec.Cmd {
+	dockerRunCommand := dockerRunNsenterCommand(target, debugImage, append(util.EnvCliCallsForDockerRun(target.Env), extraDockerRunArgs...))
+	dockerRunCommand = append(dockerRunCommand, "/bin/bash", "-c", script)
+
+	c := exec.Command(runtimeExecutableOrExit(), dockerRunCommand[1:]...)
+	c.Env = os.Environ()
+	return c
+}
+
+// shellQuote quotes s for usage as a single argument in a bash script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func dockerRunNsenterCommand(target *util.Target, debugImage string, extraDockerRunArgs []string) []string {
+	result := dockerRunCommand(target.Name, debugImage, extraDockerRunArgs)
 	result = append(result,
-		nsenterCommand(pid)...,
+		nsenterCommand(target.Pid)...,
 	)
 	return result
 }
 
+// dockerRunCommand returns the "docker run" (or "podman run") command line for the helper container; including the
+// name of the runtime CLI as first element.
 func dockerRunCommand(fullContainerName, debugImage string, extraDockerRunArgs []string) []string {
+	runtime := runtimeOrExit()
 	result := []string{
-		"docker", "run",
+		runtime.Name(), "run",
 		"--rm", // ephemeral container
 		"--name",
 		fullContainerName + "_DEBUG",
@@ -23,15 +132,15 @@ func dockerRunCommand(fullContainerName, debugImage string, extraDockerRunArgs [
 	result = append(result, extraDockerRunArgs...)
 
 	result = append(result,
-		debugImage,
+		runtime.HelperImage(debugImage),
 	)
 	return result
 }
 
-func nsenterCommand(pid string) []string {
+func nsenterCommand(pid int) []string {
 	return []string{
 		"nsenter",
-		"--target", pid, // we want to attach to the found target PID
+		"--target", strconv.Itoa(pid), // we want to attach to the found target PID
 		// IPC seems necessary, but not 100% sure why.
 		"--ipc",
 		// we want to share the PID namespace. This means:
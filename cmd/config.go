@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// loadConfigOrExit loads the effective drydock configuration for the given target (which may be nil, if no target
+// is known); i.e. the config files with the overrides of the target's compose service (or container name) applied.
+func loadConfigOrExit(target *util.Target) util.Config {
+	config, _, err := util.LoadConfig(".")
+	if err != nil {
+		color.Printf("<red>FATAL: Could not load drydock configuration: %s</>\n", err)
+		os.Exit(1)
+	}
+	if target == nil {
+		return config
+	}
+
+	if target.ComposeService != "" {
+		config = config.ForService(target.ComposeService)
+	}
+	config = config.ForService(target.Name)
+
+	if config.Php.IniDir != "" {
+		// the helper container gets the target's env, so overriding PHP_INI_DIR here makes the scripts use it as well.
+		target.Env = append(target.Env, "PHP_INI_DIR="+config.Php.IniDir)
+	}
+	return config
+}
+
+// stringFlagOrConfig returns the flag value if it was given on the command line, and the config value otherwise.
+func stringFlagOrConfig(cmd *cobra.Command, flagName string, flagValue string, configValue string) string {
+	if cmd.Flags().Changed(flagName) || configValue == "" {
+		return flagValue
+	}
+	return configValue
+}
+
+func intFlagOrConfig(cmd *cobra.Command, flagName string, flagValue int, configValue int) int {
+	if cmd.Flags().Changed(flagName) || configValue == 0 {
+		return flagValue
+	}
+	return configValue
+}
+
+// boolFlagOrConfig is like stringFlagOrConfig; configValue is nil if it is not set in the config.
+func boolFlagOrConfig(cmd *cobra.Command, flagName string, flagValue bool, configValue *bool) bool {
+	if cmd.Flags().Changed(flagName) || configValue == nil {
+		return flagValue
+	}
+	return *configValue
+}
+
+func buildConfigCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "config",
+		Short: "Sub-Commands for inspecting the drydock configuration",
+	}
+
+	command.AddCommand(buildConfigShowCommand())
+
+	return command
+}
+
+func buildConfigShowCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "show [SERVICE-or-CONTAINER]",
+		Short: "Print the effective configuration (optionally for the given service)",
+		Long: color.Sprintf(`Usage:	drydock config show [SERVICE-OR-CONTAINER]
+
+Print the effective drydock configuration, merged from the built-in defaults, the user config
+<op=italic;>~/.config/drydock/config.yaml</> and the nearest <op=italic;>.drydock.yaml</> in the current or a parent directory.
+
+If a docker compose service (or container name) is given, its overrides from the <op=italic;>services:</> section
+are applied.
+
+<op=underscore;>Example .drydock.yaml</>
+
+	debugImage: nicolaka/netshoot
+	php:
+	  iniDir: /usr/local/etc/php
+	  reloadCommand: pkill -USR2 php-fpm
+	xdebug:
+	  mode: develop,debug
+	  clientHost: host.docker.internal
+	  clientPort: 9003
+	spx:
+	  key: dev
+	pathMappings:
+	  /app: ./app
+	services:
+	  neos:
+	    php:
+	      reloadCommand: supervisorctl restart php-fpm
+
+Command line flags always override values from the configuration.
+`),
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, loadedFiles, err := util.LoadConfig(".")
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				config = config.ForService(args[0])
+				config.Services = nil
+			}
+
+			if len(loadedFiles) == 0 {
+				color.Println("<gray># no config files found, showing built-in defaults</>")
+			}
+			for _, file := range loadedFiles {
+				color.Printf("<gray># loaded %s</>\n", file)
+			}
+
+			res, err := yaml.Marshal(config)
+			if err != nil {
+				return err
+			}
+			os.Stdout.Write(res)
+			return nil
+		},
+	}
+
+	return command
+}
@@ -2,39 +2,42 @@ package cmd
 
 import (
 	"github.com/gookit/color"
-	"github.com/jonhadfield/findexec"
 	"github.com/sandstorm/drydock/util"
 	"github.com/spf13/cobra"
-	"log"
 	"os"
 	"os/exec"
 	"os/signal"
 )
 
-// phpExcimerInstallScript is running in the debugImage
-//   - we mount the inner container to /container (should be based on some base "official" Docker PHP image)
-//   - reload the config
-func phpExcimerInstallScript(pid string) string {
-	// fall back to xdebug 3.1.6 for PHP 7.4 if xdebug 3.2 (the newest version) did not work
-	return mountSlashContainer + `
+// phpExcimerBuild compiles the given excimer version via pecl inside the container; it is only run if the extension
+// cache has no excimer.so for the PHP build of the container yet.
+func phpExcimerBuild(version string) phpExtensionBuild {
+	return phpExtensionBuild{
+		Name:    "excimer",
+		Version: version,
+		Script: mountSlashContainer + `
 cat << EOF | chroot /container
 	export HTTP_PROXY=""
 	export HTTPS_PROXY=""
-	pecl install excimer
+	pecl install -f ` + peclPackage("excimer", version) + `
 EOF
+`,
+		// pecl downloads the sources
+		Net: true,
+	}
+}
 
-if [ ! -d /container$PHP_INI_DIR ]; then
-    echo "!!!! PHP_INI_DIR not set."
-    echo "!!!! please set it as env in docker compose."
-    exit 1
-fi;
-
-cat << EOF > /container$PHP_INI_DIR/conf.d/excimer.ini
-auto_prepend_file=/app/tracing/auto_prepend_file.php
+// phpExcimerInstallScript is running in the debugImage, after excimer.so was installed via phpExcimerBuild
+//   - we mount the inner container to /container
+//   - write excimer.ini into the ini scan dirs found by the PHP probe
+//
+// PHP is reloaded afterwards via reloadPhp.
+func phpExcimerInstallScript(php *util.PhpRuntime) string {
+	return mountSlashContainer + phpIniWriteScript(php.IniFiles("excimer.ini"), `auto_prepend_file=/app/tracing/auto_prepend_file.php
 
 extension=excimer.so
 
-EOF
+`) + `
 
 mkdir -p /container/app/tracing
 mkdir -p /container/app/tracing/_traces
@@ -70,26 +73,23 @@ function startExcimer() {
 startExcimer();
 
 EOF
-
-echo "restarting php-fpm"
-pkill -USR2 php-fpm
 `
 }
 
-func phpXExcimerDeactivateScript() string {
-	return mountSlashContainer + `
-rm /container$PHP_INI_DIR/conf.d/excimer.ini
-pkill -USR2 php-fpm
-`
+func phpXExcimerDeactivateScript(php *util.PhpRuntime) string {
+	return mountSlashContainer + phpIniRemoveScript(php.IniFiles("excimer.ini"))
 }
 
 func buildExcimerCommand() *cobra.Command {
 	var debugImage string = "nicolaka/netshoot"
+	var reload phpReloadOptions
+	var extensionVersion string
+	var source string
 
 	var command = &cobra.Command{
-		Use:   "excimer [flags] SERVICE-or-CONTAINER",
+		Use:   "excimer [flags] [SERVICE-or-CONTAINER]",
 		Short: "Install Excimer Sampling Continuous Profiler in the given container",
-		Long: color.Sprintf(`Usage:	drydock excimer [flags] SERVICE-OR-CONTAINER
+		Long: color.Sprintf(`Usage:	drydock excimer [flags] [SERVICE-OR-CONTAINER]
 
 Run excimer Continuous Profiler in the given PHP Container, and reloads
 the PHP Process such that the debugger is enabled.
@@ -97,6 +97,11 @@ the PHP Process such that the debugger is enabled.
 <op=underscore;>Options:</>
       --debug-image          What debugger docker image to use for executing nsenter (and optionally the NFS webdav server).
                              By default, nicolaka/netshoot is used
+      --version              Version to install, e.g. 1.2.2 or latest. By default, the known-good version for the
+                             PHP version of the container is used (shown by drydock php-info)
+      --source               Build from local sources instead of downloading them, e.g. ./excimer-1.2.2.tgz: a tarball,
+                             a directory with the extracted sources, or a directory with pre-fetched tarballs
+` + phpReloadOptionsHelp + `
 
 <op=underscore;>Examples</>
 
@@ -109,13 +114,15 @@ the PHP Process such that the debugger is enabled.
 <op=underscore;>Background:</>
 
     This command installs the excimer PHP extension into an existing Docker container, even if the container is locked
-    down to a non-root user. Additionally, we reload the PHP process by using kill -USR2.
+    down to a non-root user. Additionally, we reload PHP depending on the detected SAPI (see --reload), and check that
+    the extension is active (the .so exists, php -m lists it, and the php-fpm workers were restarted). If not, it is
+    removed again, and drydock exits with a non-zero exit code.
 
     This command is using <op=italic;>nsenter</> wrapped in a privileged docker container to install the PHP extension
     inside a running container as root.
 
 `),
-		Args: cobra.ExactArgs(1),
+		Args: cobra.MaximumNArgs(1),
 
 		Run: func(cmd *cobra.Command, args []string) {
 			//isOpen := isXdebugPortOpenInIde("127.0.0.1", "9003")
@@ -128,58 +135,54 @@ the PHP Process such that the debugger is enabled.
 			color.Println("<green>=====================================</>")
 			color.Println("")
 
-			dockerContainerIdentifier, err := util.TryGetDockerContainerNameFromDockerCompose(args[0])
-
-			if err != nil {
-				// could not identify the docker container identifier; e.g. no docker-compose used.
-				dockerContainerIdentifier = args[0]
-			} else {
-				color.Printf("<green>docker compose service </><fg=green;op=bold;>%s</><fg=green> found, entering it.</>\n", args[0])
-				color.Println("")
+			target := resolveTargetOrExit(targetIdentifierFromArgsOrPick(args))
+			config := loadConfigOrExit(target)
+			debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
+			reload = phpReloadOptionsFromFlagsOrConfig(cmd, reload, config)
+			if err := reload.validate(); err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
+				os.Exit(1)
 			}
 
-			pid, err := util.GetRootPidForDockerContainer(dockerContainerIdentifier)
+			runtimeExecutable := runtimeExecutableOrExit()
 
-			if err != nil || pid == "0" {
-				// container not running
-				color.Printf("<red>FATAL: Container </><fg=red;op=bold;>%s</><fg=red> not running.</>\n", dockerContainerIdentifier)
-				color.Println("")
-				os.Exit(1)
-			}
+			// we need to get the ENV of the original container (e.g. PATH and PHP_INI_DIR) for the scripts.
+			extraDockerRunArgs := util.EnvCliCallsForDockerRun(target.Env)
+			php := probePhpRuntimeOrExit(target, debugImage, config)
 
-			fullContainerName, err := util.GetFullContainerName(dockerContainerIdentifier)
+			// Install excimer (from the extension cache, or built once)
+			build, err := phpExtensionBuildFor(cmd, "excimer", extensionVersion, source, php, phpExcimerBuild)
 			if err != nil {
-				color.Printf("<red>FATAL: Could not extract container name for container </><fg=red;op=bold;>%s</><fg=red> - THIS SHOULD NOT HAPPEN. Please file a bug report.</>\n", dockerContainerIdentifier)
-				color.Println("")
+				color.Printf("<red>FATAL: %s</>\n", err)
 				os.Exit(1)
 			}
-
-			dockerExecutablePathAndFilename := findexec.Find("docker", "")
-
-			// we need to get the ENV of the original container to find the PHP_INI_DIR (needed such that "docker-php-ext-enable" will work: https://github.com/docker-library/php/blob/67c242cb1529c70a3969a373ab333c53001c95b8/8.2-rc/bullseye/cli/docker-php-ext-enable)
-			extraDockerRunArgs, err := util.GetEnvCliCallsForDockerRunFromContainerMetadata(fullContainerName)
-			if err != nil {
-				log.Printf("FATAL: Could not extract env variables for container '%s': %s - THIS SHOULD NOT HAPPEN. Please file a bug report.\n", dockerContainerIdentifier, err)
+			if err := installPhpExtension(target, debugImage, php, build); err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
 				os.Exit(1)
 			}
-
-			// Install excimer
-			dockerRunCommand := dockerRunNsenterCommand(fullContainerName, debugImage, pid, extraDockerRunArgs)
-			dockerRunCommand = append(dockerRunCommand, "--net") // to download files now, we need to mount the network filesystem.
+			dockerRunCommand := dockerRunNsenterCommand(target, debugImage, extraDockerRunArgs)
 			dockerRunCommand = append(dockerRunCommand, "/bin/bash")
 			dockerRunCommand = append(dockerRunCommand, "-c")
-			dockerRunCommand = append(dockerRunCommand, phpExcimerInstallScript(pid))
+			excimerIniFiles := php.IniFiles("excimer.ini")
+			dockerRunCommand = append(dockerRunCommand, journaledScript(phpExcimerInstallScript(php), newJournalEntry("excimer", util.JournalActionInstall, build.Version, append(excimerIniFiles, "/app/tracing")...)))
+			deactivateScript := journaledScript(phpXExcimerDeactivateScript(php), newJournalEntry("excimer", util.JournalActionRemove, build.Version, excimerIniFiles...))
 
-			dockerRunC := exec.Command(dockerExecutablePathAndFilename, dockerRunCommand[1:]...)
+			dockerRunC := exec.Command(runtimeExecutable, dockerRunCommand[1:]...)
 			dockerRunC.Env = os.Environ()
 			dockerRunC.Stdout = os.Stdout
 			dockerRunC.Stderr = os.Stderr
-			dockerRunC.Run()
+			if err := dockerRunC.Run(); err != nil {
+				color.Printf("<red>ERROR: writing excimer.ini failed: %s</>\n", err)
+				revertPhpExtensionAndExit(target, debugImage, php, reload, "excimer", deactivateScript)
+			}
+			if !activatePhpExtension(target, debugImage, php, reload, "excimer") {
+				revertPhpExtensionAndExit(target, debugImage, php, reload, "excimer", deactivateScript)
+			}
 
 			c := make(chan os.Signal, 1)
 			signal.Notify(c, os.Interrupt)
 
-			printExcimerUsage(fullContainerName)
+			printExcimerUsage(target.Name)
 			// wait for ctrl-c
 			<-c
 			color.Println("<fg=yellow>Ctrl-C pressed. Aborting...</>")
@@ -190,16 +193,22 @@ the PHP Process such that the debugger is enabled.
 			color.Println("")
 			// Removing XDebug
 			// Install XDEBUG and prepare for NFS Server
-			dockerRunCommand = dockerRunNsenterCommand(fullContainerName, debugImage, pid, extraDockerRunArgs)
+			dockerRunCommand = dockerRunNsenterCommand(target, debugImage, extraDockerRunArgs)
 			dockerRunCommand = append(dockerRunCommand, "/bin/bash")
 			dockerRunCommand = append(dockerRunCommand, "-c")
-			dockerRunCommand = append(dockerRunCommand, phpXExcimerDeactivateScript())
+			dockerRunCommand = append(dockerRunCommand, deactivateScript)
 
-			dockerRunC = exec.Command(dockerExecutablePathAndFilename, dockerRunCommand[1:]...)
+			dockerRunC = exec.Command(runtimeExecutable, dockerRunCommand[1:]...)
 			dockerRunC.Env = os.Environ()
 			dockerRunC.Stdout = os.Stdout
 			dockerRunC.Stderr = os.Stderr
-			dockerRunC.Run()
+			if err := dockerRunC.Run(); err != nil {
+				color.Printf("<red>ERROR: disabling excimer failed: %s</>\n", err)
+				os.Exit(1)
+			}
+			if err := reloadPhp(target, debugImage, php, reload); err != nil {
+				color.Printf("<red>ERROR: %s</>\n", err)
+			}
 
 			color.Println("<green>=====================================</>")
 			color.Printf("<green>All done!</>\n")
@@ -209,6 +218,9 @@ the PHP Process such that the debugger is enabled.
 		},
 	}
 
+	command.Flags().StringVar(&extensionVersion, "version", "", "Excimer version to install, e.g. 1.2.2 or latest (default: the known-good version for the PHP version)")
+	command.Flags().StringVar(&source, "source", "", "Build from local sources (a tarball like excimer-1.2.2.tgz, or a directory) without network access")
+	addPhpReloadFlags(command, &reload)
 	command.Flags().StringVarP(&debugImage, "debug-image", "", "nicolaka/netshoot", "What debugger docker image to use for executing nsenter. By default, gists/nfs-server is used")
 
 	return command
@@ -1,11 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"github.com/gookit/color"
-	"github.com/jonhadfield/findexec"
 	"github.com/sandstorm/drydock/util"
 	"github.com/spf13/cobra"
-	"log"
 	"os"
 	"syscall"
 )
@@ -13,19 +12,22 @@ import (
 func buildExecRootCmd() *cobra.Command {
 	var noMount bool = false // by default, we mount the target
 	var debugImage string = "nicolaka/netshoot"
+	var native bool = false
 
 	var execRootCmd = &cobra.Command{
-		Use:   "execroot [flags] SERVICE-or-CONTAINER COMMAND [ARG...]",
+		Use:   "execroot [flags] [SERVICE-or-CONTAINER-or-pod/NAME] [COMMAND [ARG...]]",
 		Short: "executes a command or an interactive shell ('docker-compose exec' or 'docker exec'), but enters the container as root in all cases",
-		Long: color.Sprintf(`Usage:	drydock execroot [flags] SERVICE-OR-CONTAINER COMMAND [ARG...]
+		Long: color.Sprintf(`Usage:	drydock execroot [flags] [SERVICE-OR-CONTAINER-OR-pod/NAME[:container]] [COMMAND [ARG...]]
 
-Run a command AS ROOT in a running container or docker-compose service.
+Run a command AS ROOT in a running container, docker-compose service or Kubernetes pod.
 
 <op=underscore;>Options:</>
       --no-chroot            Do not enter the target container file system, but stay in the
                              debug-image. Target container is mounted in /container 
       --debug-image          What debugger docker image to use for executing nsenter.
                              By default, nicolaka/netshoot is used 
+      --native               Linux only: enter the container directly via setns, without starting a
+                             privileged debug container. Needs root (e.g. sudo) or CAP_SYS_ADMIN.
 
 <op=underscore;>Examples</>
 
@@ -35,6 +37,9 @@ Run a command AS ROOT in a running container or docker-compose service.
 <op=bold;>Get a root shell in a running docker-compose service</>
 	drydock execroot <op=italic;>my-docker-compose-service</>
 
+<op=bold;>Choose the container interactively from a list of running containers</>
+	drydock execroot
+
 <op=bold;>Execute a command as root</>
 	drydock execroot <op=italic;>myContainer</> whoami
 
@@ -44,51 +49,61 @@ Run a command AS ROOT in a running container or docker-compose service.
 <op=bold;>Change the debug container</>
 	drydock execroot --no-chroot --debug-image=alpine <op=italic;>myContainer</>
 
+<op=bold;>Get a root shell in a Kubernetes pod (container "php" of pod "my-app-1234" in namespace "shop")</>
+	drydock execroot --namespace shop <op=italic;>pod/my-app-1234:php</>
+
+<op=bold;>Enter the container instantly, without a debug container (Linux, as root)</>
+	sudo drydock execroot --native <op=italic;>myContainer</>
+
 <op=underscore;>Background:</>
 
     <op=italic;>docker-compose exec</> or <op=italic;>docker exec</> respect the USER specified in the Dockerfile; and it is
     not easily possible to break out of this user (e.g. to install an additional tool as root).
 
     This command is using <op=italic;>nsenter</> wrapped in a privileged docker container to enter a running container as root.
+
+    With <op=italic;>--native</>, drydock enters the namespaces of the container itself (like nsenter), and chroots into
+    <op=italic;>/proc/PID/root</>. This only works if docker runs on the same Linux host (i.e. not with Docker Desktop).
+
+    For Kubernetes pods, a privileged debug pod (in the host PID namespace) is started on the node of the pod,
+    and removed again when the shell exits. <op=italic;>kubectl</> needs to be installed.
 `),
-		Args: cobra.MinimumNArgs(1),
+		Args: cobra.ArbitraryArgs,
 
 		Run: func(cmd *cobra.Command, args []string) {
-			dockerContainerIdentifier, err := util.TryGetDockerContainerNameFromDockerCompose(args[0])
-
-			if err != nil {
-				// could not identify the docker container identifier; e.g. no docker-compose used.
-				dockerContainerIdentifier = args[0]
-			} else {
-				log.Printf("docker compose service '%s' found, entering it.\n", args[0])
+			identifier := targetIdentifierFromArgsOrPick(args)
+			if util.IsKubernetesTarget(identifier) {
+				if native {
+					color.Println("<red>FATAL: --native is not supported for kubernetes pods.</>")
+					os.Exit(1)
+				}
+				config := loadConfigOrExit(nil)
+				debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
+				var command []string
+				if len(args) > 1 {
+					command = args[1:]
+				}
+				kubernetesExecRoot(identifier, debugImage, noMount, command)
+				return
 			}
 
-			pid, err := util.GetRootPidForDockerContainer(dockerContainerIdentifier)
+			target := resolveTargetOrExit(identifier)
+			config := loadConfigOrExit(target)
+			debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
 
-			if err != nil {
-				// container not running
-				log.Printf("FATAL: Container '%s' not running\n", dockerContainerIdentifier)
-				os.Exit(1)
+			if native {
+				execRootNative(target, noMount, args)
+				return
 			}
 
-			fullContainerName, err := util.GetFullContainerName(dockerContainerIdentifier)
-			if err != nil {
-				log.Printf("FATAL: Could not extract container name for container '%s' - THIS SHOULD NOT HAPPEN. Please file a bug report.\n", dockerContainerIdentifier)
-				os.Exit(1)
-			}
-
-			dockerExecutablePathAndFilename := findexec.Find("docker", "")
+			runtimeExecutable := runtimeExecutableOrExit()
 
 			// we need to get the ENV of the original container, needed such that f.e. "docker-php-ext-enable" will work: https://github.com/docker-library/php/blob/67c242cb1529c70a3969a373ab333c53001c95b8/8.2-rc/bullseye/cli/docker-php-ext-enable
-			envVars, err := util.GetEnvCliCallsForDockerRunFromContainerMetadata(fullContainerName)
-			if err != nil {
-				log.Printf("FATAL: Could not extract env variables for container '%s': %s - THIS SHOULD NOT HAPPEN. Please file a bug report.\n", dockerContainerIdentifier, err)
-				os.Exit(1)
-			}
+			envVars := util.EnvCliCallsForDockerRun(target.Env)
 
 			envVars = append(envVars, "-it") // interactive, with TTY
 
-			dockerRunCommand := dockerRunNsenterCommand(fullContainerName, debugImage, pid, envVars)
+			dockerRunCommand := dockerRunNsenterCommand(target, debugImage, envVars)
 			// we want to share the network namespace. This means you can e.g. use `curl` like in the debugged application,
 			// using "127.0.0.1:[yourport]" as usual.
 			dockerRunCommand = append(dockerRunCommand, "--net")
@@ -128,13 +143,56 @@ Run a command AS ROOT in a running container or docker-compose service.
 				}
 			}
 
-			syscall.Exec(dockerExecutablePathAndFilename, dockerRunCommand, os.Environ())
+			syscall.Exec(runtimeExecutable, dockerRunCommand, os.Environ())
 		},
 	}
 
 	execRootCmd.Flags().SetInterspersed(false)
 	execRootCmd.Flags().BoolVarP(&noMount, "no-chroot", "", false, "Do not enter the target container file system, but stay in the debug-image. Target container is mounted in /container")
+	execRootCmd.Flags().BoolVarP(&native, "native", "", false, "Linux only: enter the container via setns, without a privileged debug container. Needs root or CAP_SYS_ADMIN")
 	execRootCmd.Flags().StringVarP(&debugImage, "debug-image", "", "nicolaka/netshoot", "What debugger docker image to use for executing nsenter. By default, nicolaka/netshoot is used")
 
 	return execRootCmd
 }
+
+// execRootNative is execroot without the debug container: drydock enters the namespaces of the target itself.
+func execRootNative(target *util.Target, noMount bool, args []string) {
+	options := util.NsenterOptions{
+		Pid:         target.Pid,
+		ContainerID: target.ID,
+		Net:         true,
+		Chroot:      !noMount,
+		Env:         target.Env,
+		Command:     []string{"/bin/bash"},
+	}
+	if term, ok := os.LookupEnv("TERM"); ok {
+		// docker run -it sets TERM as well.
+		options.Env = append([]string{"TERM=" + term}, options.Env...)
+	}
+	if noMount {
+		// we stay in the host file system, so the host tooling (and environment) is used.
+		options.Env = os.Environ()
+		options.Command = []string{"/bin/bash", "-l"}
+		color.Printf("<op=bold;>-----------------------------------------------------------</>\n")
+		color.Printf("The debugged container file system is available in <op=bold;>/proc/%d/root</>\n", target.Pid)
+		color.Printf("<op=bold;>-----------------------------------------------------------</>\n")
+	}
+	if len(args) > 1 {
+		options.Command = args[1:]
+	}
+
+	exitCode, err := util.RunInNamespaces(options)
+	if err != nil {
+		var permissionErr *util.NsenterPermissionError
+		switch {
+		case errors.Is(err, util.ErrNativeNsenterUnsupported):
+			color.Printf("<red>FATAL: %s. Run without --native.</>\n", err)
+		case errors.As(err, &permissionErr):
+			color.Printf("<red>FATAL: %s. Run with sudo, or without --native.</>\n", err)
+		default:
+			color.Printf("<red>FATAL: %s</>\n", err)
+		}
+		os.Exit(1)
+	}
+	os.Exit(exitCode)
+}
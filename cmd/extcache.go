@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+)
+
+// phpExtensionBuild describes how to build a PHP extension inside the target container.
+type phpExtensionBuild struct {
+	// Name of the extension; the build installs Name.so into the extension_dir.
+	Name string
+	// Version is part of the cache key, e.g. 3.3.2 or "latest" (see phpExtensionVersion).
+	Version string
+	// Script builds and installs the extension; the container is mounted at /container.
+	Script string
+	// Net enters the network namespace of the container during the build (e.g. for pecl downloads).
+	Net bool
+	// Source are local sources (--source), which are copied into the container before Script runs.
+	Source *util.PhpExtensionSource
+	// Uncached builds are not stored in the extension cache, as their sources have no version. Builds of "latest" are
+	// never cached either (see installPhpExtension).
+	Uncached bool
+}
+
+// phpExtensionVersion is the version of the extension to install: the --version flag if given, otherwise the
+// known-good version for the PHP version from the compatibility matrix (util/extversions.yaml).
+func phpExtensionVersion(cmd *cobra.Command, name string, flagValue string, php *util.PhpRuntime) (string, error) {
+	if cmd.Flags().Changed("version") {
+		return flagValue, util.ValidatePhpExtensionVersion(flagValue)
+	}
+	version, ok := util.DefaultPhpExtensionVersions().For(name, php.MinorVersion())
+	if !ok {
+		color.Printf("<fg=yellow>No known-good %s version for PHP %s - trying the latest release (pin one with --version).</>\n", name, php.MinorVersion())
+		return util.PhpExtensionVersionLatest, nil
+	}
+	return version, nil
+}
+
+// peclPackage is the argument of "pecl install" for the given version, e.g. xdebug-3.3.2
+func peclPackage(name string, version string) string {
+	if version == util.PhpExtensionVersionLatest {
+		return name
+	}
+	return name + "-" + version
+}
+
+// installPhpExtension puts Name.so into the extension_dir of the target: copied from the extension cache, if it was
+// built for the same PHP build before; otherwise it is built with the build script, and then stored in the cache.
+func installPhpExtension(target *util.Target, debugImage string, php *util.PhpRuntime, build phpExtensionBuild) error {
+	if build.Uncached {
+		color.Printf("<green>Building </><fg=green;op=bold;>%s</><green> from %s (not cached, as the sources have no version)</>\n", build.Name, build.Source.Path)
+		return runPhpExtensionBuild(target, debugImage, build)
+	}
+	if build.Version == util.PhpExtensionVersionLatest {
+		// "latest" is a different release over time; a cached build would be reused even after a new release.
+		color.Printf("<green>Building the latest </><fg=green;op=bold;>%s</><green> release (not cached, pin a version with --version to cache it)</>\n", build.Name)
+		return runPhpExtensionBuild(target, debugImage, build)
+	}
+
+	key := php.BuildKey()
+	cache, err := util.DefaultExtensionCache()
+	if err != nil {
+		color.Printf("<fg=yellow>%s - building %s without cache.</>\n", err, build.Name)
+		return runPhpExtensionBuild(target, debugImage, build)
+	}
+
+	soFile := path.Join(php.ExtensionDir, build.Name+".so")
+	if cachedFile, ok := cache.Lookup(build.Name, build.Version, key); ok {
+		color.Printf("<green>Using cached </><fg=green;op=bold;>%s %s</><green> for %s</>\n", build.Name, build.Version, key)
+		return copyFileIntoContainer(target, debugImage, cachedFile, soFile)
+	}
+
+	color.Printf("<green>Building </><fg=green;op=bold;>%s %s</><green> for %s (not cached yet)</>\n", build.Name, build.Version, key)
+	if err := runPhpExtensionBuild(target, debugImage, build); err != nil {
+		return err
+	}
+
+	err = cache.Store(build.Name, build.Version, key, func(w io.Writer) error {
+		// the entry is only committed if cat succeeded; a failure partway would leave a truncated .so otherwise.
+		c := helperScriptCommand(target, debugImage, mountSlashContainer+"\ncat "+shellQuote("/container"+soFile))
+		c.Stdout = w
+		c.Stderr = os.Stderr
+		return c.Run()
+	})
+	if err != nil {
+		// the extension is installed nevertheless; it is just built again next time.
+		color.Printf("<fg=yellow>Could not store %s in the extension cache: %s</>\n", soFile, err)
+		return nil
+	}
+	color.Printf("<green>Stored %s in the extension cache.</>\n", build.Name)
+	return nil
+}
+
+// runPhpExtensionBuild runs the build script; its output is shown, and also captured in a build log, which is kept
+// if the build fails.
+func runPhpExtensionBuild(target *util.Target, debugImage string, build phpExtensionBuild) error {
+	buildLog, err := os.CreateTemp("", "drydock-"+build.Name+"-build-*.log")
+	if err != nil {
+		return err
+	}
+	defer buildLog.Close()
+
+	if build.Source != nil {
+		if err := copyPhpExtensionSource(target, debugImage, build); err != nil {
+			return err
+		}
+	}
+
+	dockerRunCommand := dockerRunNsenterCommand(target, debugImage, util.EnvCliCallsForDockerRun(target.Env))
+	if build.Net {
+		dockerRunCommand = append(dockerRunCommand, "--net")
+	}
+	dockerRunCommand = append(dockerRunCommand, "/bin/bash", "-c", build.Script)
+
+	c := exec.Command(runtimeExecutableOrExit(), dockerRunCommand[1:]...)
+	c.Env = os.Environ()
+	c.Stdout = io.MultiWriter(os.Stdout, buildLog)
+	c.Stderr = io.MultiWriter(os.Stderr, buildLog)
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("building %s failed: %w - see the build log %s", build.Name, err, buildLog.Name())
+	}
+	os.Remove(buildLog.Name())
+	return nil
+}
+
+// copyFileIntoContainer streams the local file into the container (through stdin of the helper container). The file
+// is written under a temporary name and then renamed, so that PHP never loads a partially written file.
+func copyFileIntoContainer(target *util.Target, debugImage string, localFile string, containerFile string) error {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	destination := shellQuote("/container" + containerFile)
+	temporary := shellQuote("/container" + containerFile + ".drydock-tmp")
+	script := mountSlashContainer + fmt.Sprintf(`
+mkdir -p "$(dirname %s)"
+cat > %s && chmod 644 %s && mv %s %s
+`, destination, temporary, temporary, temporary, destination)
+
+	c := helperScriptCommand(target, debugImage, script, "-i")
+	c.Stdin = file
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("could not copy %s into the container: %w", containerFile, err)
+	}
+	return nil
+}
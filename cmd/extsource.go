@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+// phpExtensionBuildFor is the build of the extension for the --version and --source flags: from the local sources if
+// --source is given, otherwise with download, which fetches the sources (pecl or git) during the build.
+func phpExtensionBuildFor(cmd *cobra.Command, name string, flagVersion string, source string, php *util.PhpRuntime, download func(version string) phpExtensionBuild) (phpExtensionBuild, error) {
+	if source == "" {
+		version, err := phpExtensionVersion(cmd, name, flagVersion, php)
+		if err != nil {
+			return phpExtensionBuild{}, err
+		}
+		return download(version), nil
+	}
+
+	// the version picks the tarball from a directory of pre-fetched tarballs.
+	knownGood, _ := util.DefaultPhpExtensionVersions().For(name, php.MinorVersion())
+	version := knownGood
+	if cmd.Flags().Changed("version") {
+		if err := util.ValidatePhpExtensionVersion(flagVersion); err != nil {
+			return phpExtensionBuild{}, err
+		}
+		version = flagVersion
+	}
+	resolved, err := util.ResolvePhpExtensionSource(source, name, version)
+	if err != nil {
+		return phpExtensionBuild{}, err
+	}
+	if cmd.Flags().Changed("version") && resolved.Version != "" && util.NormalizePhpExtensionVersion(resolved.Version) != util.NormalizePhpExtensionVersion(version) {
+		// the version is the cache key; a mismatch would store the build under the wrong version.
+		return phpExtensionBuild{}, fmt.Errorf("%s contains %s %s, but --version is %s", resolved.Path, name, resolved.Version, version)
+	}
+	if !cmd.Flags().Changed("version") {
+		version = resolved.Version
+		if knownGood != "" && version != "" && util.NormalizePhpExtensionVersion(version) != util.NormalizePhpExtensionVersion(knownGood) {
+			color.Printf("<fg=yellow>%s contains %s %s; the known-good version for PHP %s is %s.</>\n", resolved.Path, name, version, php.MinorVersion(), knownGood)
+		}
+	}
+	return phpExtensionSourceBuild(name, resolved, version), nil
+}
+
+// phpExtensionSourceBuild compiles the extension from the sources copied into the container by
+// copyPhpExtensionSource (phpize, configure, make install); no network access is needed.
+func phpExtensionSourceBuild(name string, source *util.PhpExtensionSource, version string) phpExtensionBuild {
+	sourceDir := shellQuote("/container" + phpExtensionSourceDir(name))
+	build := phpExtensionBuild{
+		Name:    name,
+		Version: version,
+		Source:  source,
+		Script: mountSlashContainer + `
+# tarballs from pecl and GitHub contain the sources in a sub directory
+CONFIG_M4=$(find ` + sourceDir + ` -maxdepth 3 -name config.m4 | head -n 1)
+if [ -z "$CONFIG_M4" ]; then
+    echo "!!!! no config.m4 found in the sources"
+    exit 1
+fi
+SRC=$(dirname "${CONFIG_M4#/container}")
+
+cat << EOF | chroot /container
+	cd "$SRC"
+	phpize && ./configure && make && make install
+EOF
+STATUS=$?
+rm -Rf ` + sourceDir + `
+exit $STATUS
+`,
+	}
+	if version == "" {
+		build.Version = "local"
+		build.Uncached = true
+	}
+	return build
+}
+
+// phpExtensionSourceDir is where the sources are extracted inside the container.
+func phpExtensionSourceDir(name string) string {
+	return "/tmp/drydock-" + name + "-src"
+}
+
+// copyPhpExtensionSource streams the local sources into the container (through stdin of the helper container): a
+// tarball as it is, a directory packed as tar stream.
+func copyPhpExtensionSource(target *util.Target, debugImage string, build phpExtensionBuild) error {
+	var reader io.Reader
+	tarFlags := "-xf"
+	if build.Source.IsDir() {
+		pipeReader, pipeWriter := io.Pipe()
+		go func() {
+			pipeWriter.CloseWithError(util.WriteTar(build.Source.Path, pipeWriter))
+		}()
+		defer pipeReader.Close()
+		reader = pipeReader
+	} else {
+		file, err := os.Open(build.Source.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+		if build.Source.Gzipped() {
+			tarFlags = "-xzf"
+		}
+	}
+
+	color.Printf("<green>Copying the sources </><fg=green;op=bold;>%s</><green> into the container</>\n", build.Source.Path)
+	sourceDir := shellQuote("/container" + phpExtensionSourceDir(build.Name))
+	script := mountSlashContainer + `
+rm -Rf ` + sourceDir + `
+mkdir -p ` + sourceDir + `
+tar ` + tarFlags + ` - -C ` + sourceDir + `
+`
+	c := helperScriptCommand(target, debugImage, script, "-i")
+	c.Stdin = reader
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("could not copy %s into the container: %w", build.Source.Path, err)
+	}
+	return nil
+}
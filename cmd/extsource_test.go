@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPhpExtensionBuildForSource(t *testing.T) {
+	dir := t.TempDir()
+	tarball := filepath.Join(dir, "xdebug-3.3.2.tgz")
+	if err := os.WriteFile(tarball, []byte("sources"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	php := &util.PhpRuntime{Version: "8.2.12"}
+	download := func(version string) phpExtensionBuild {
+		t.Fatalf("the sources must not be downloaded")
+		return phpExtensionBuild{}
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantVersion string
+		wantErr     string
+	}{
+		{name: "version from the tarball", wantVersion: "3.3.2"},
+		{name: "matching --version", args: []string{"--version", "v3.3.2"}, wantVersion: "v3.3.2"},
+		{name: "mismatching --version", args: []string{"--version", "3.3.1"}, wantErr: "contains xdebug 3.3.2, but --version is 3.3.1"},
+		{name: "invalid --version", args: []string{"--version", "3.3.2; rm -Rf /"}, wantErr: "invalid extension version"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var flagVersion string
+			command := &cobra.Command{}
+			command.Flags().StringVar(&flagVersion, "version", "", "")
+			if err := command.ParseFlags(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			build, err := phpExtensionBuildFor(command, "xdebug", flagVersion, tarball, php, download)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if build.Version != test.wantVersion || build.Source.Path != tarball || build.Uncached {
+				t.Errorf("got version %s from %s (uncached: %v), want %s from %s", build.Version, build.Source.Path, build.Uncached, test.wantVersion, tarball)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"golang.org/x/term"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ideProbeInterval is how often the IDE is probed while an Xdebug session is active.
+const ideProbeInterval = 5 * time.Second
+
+// ideProbe checks periodically whether the IDE accepts Xdebug connections, and prints a status line:
+//   - on this machine, by connecting to 127.0.0.1:ClientPort (where the IDE listens)
+//   - from the network namespace of the container, by connecting to ClientHost:ClientPort in the sidecar (which is
+//     what Xdebug does); this also catches wrong client hosts and missing port forwards.
+//
+// Connections are seen either via the relay (see OnRelayConnection), or as established connections to the client
+// port in the network namespace of the container.
+type ideProbe struct {
+	// ClientHost is the xdebug.client_host; if empty, it is not probed from the container (e.g. for the relay, which
+	// listens in the container itself).
+	ClientHost string
+	ClientPort int
+	// sidecar is used to probe from inside the network namespace of the container; if nil, only this machine is
+	// probed.
+	sidecar *networkSidecar
+
+	mutex              sync.Mutex
+	hostListening      bool
+	containerReachable *bool
+	activeConnections  int
+	lastConnection     time.Time
+	lastRelayError     error
+	lastStatus         string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// warnIfIdeNotListening is the check before Xdebug is enabled; it only warns, as the IDE may be started later.
+func warnIfIdeNotListening(clientPort int) {
+	if isXdebugPortOpenInIde("127.0.0.1", strconv.Itoa(clientPort)) {
+		color.Printf("<green>IDE is listening on </><fg=green;op=bold;>127.0.0.1:%d</>\n", clientPort)
+		return
+	}
+	color.Println("<fg=yellow>=====================================</>")
+	color.Printf("<fg=yellow;op=bold;>WARNING: Nothing is listening on 127.0.0.1:%d on this machine.</>\n", clientPort)
+	color.Println("<fg=yellow>Xdebug cannot connect to your IDE until you enable</>")
+	color.Println("<fg=yellow>  </><fg=yellow;op=bold;>Run -> Start Listening for PHP Debug Connections</><fg=yellow> (PHPStorm/IntelliJ).</>")
+	color.Println("<fg=yellow>=====================================</>")
+}
+
+func newIdeProbe(clientHost string, clientPort int, sidecar *networkSidecar) *ideProbe {
+	return &ideProbe{
+		ClientHost: clientHost,
+		ClientPort: clientPort,
+		sidecar:    sidecar,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start probes once, and then every ideProbeInterval until Stop is called.
+func (p *ideProbe) Start() {
+	go p.run()
+}
+
+// Stop ends probing, and finishes the status line.
+func (p *ideProbe) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+}
+
+// OnRelayConnection is the OnConnection callback for the Xdebug relay.
+func (p *ideProbe) OnRelayConnection(err error) {
+	p.mutex.Lock()
+	p.lastConnection = time.Now()
+	p.lastRelayError = err
+	p.mutex.Unlock()
+	p.printStatus()
+}
+
+func (p *ideProbe) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(ideProbeInterval)
+	defer ticker.Stop()
+	for {
+		p.probe()
+		p.printStatus()
+		select {
+		case <-p.stop:
+			if stdoutIsTerminal() {
+				fmt.Println()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *ideProbe) probe() {
+	hostListening := isXdebugPortOpenInIde("127.0.0.1", strconv.Itoa(p.ClientPort))
+	var containerReachable *bool
+	activeConnections := 0
+	if p.sidecar != nil {
+		containerReachable, activeConnections = p.probeInContainer()
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.hostListening = hostListening
+	p.containerReachable = containerReachable
+	if activeConnections > 0 {
+		p.lastConnection = time.Now()
+	}
+	p.activeConnections = activeConnections
+}
+
+// probeInContainer connects to the client host from the network namespace of the container, and counts the
+// established connections to the client port (i.e. running debug sessions). If the client host was not probed, or
+// the sidecar could not be used, reachable is nil.
+func (p *ideProbe) probeInContainer() (reachable *bool, activeConnections int) {
+	port := strconv.Itoa(p.ClientPort)
+	script := fmt.Sprintf(`
+if [ -z %s ]; then echo skipped
+elif nc -z -w 2 %s %s >/dev/null 2>&1; then echo reachable
+else echo unreachable; fi
+ss -Htn state established "( dport = :%s )" 2>/dev/null | wc -l
+`, shellQuote(p.ClientHost), shellQuote(p.ClientHost), port, port)
+	output, err := p.sidecar.Command(false, "/bin/sh", "-c", script).Output()
+	if err != nil {
+		return nil, 0
+	}
+
+	lines := strings.Fields(string(output))
+	if len(lines) != 2 {
+		return nil, 0
+	}
+	activeConnections, _ = strconv.Atoi(lines[1])
+	if lines[0] == "skipped" {
+		return nil, activeConnections
+	}
+	isReachable := lines[0] == "reachable"
+	return &isReachable, activeConnections
+}
+
+func (p *ideProbe) status() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var parts []string
+	if p.hostListening {
+		parts = append(parts, color.Sprintf("<green>IDE listening on 127.0.0.1:%d</>", p.ClientPort))
+	} else {
+		parts = append(parts, color.Sprintf("<fg=yellow;op=bold;>IDE NOT listening on 127.0.0.1:%d</>", p.ClientPort))
+	}
+	if p.containerReachable != nil {
+		if *p.containerReachable {
+			parts = append(parts, color.Sprintf("<green>%s:%d reachable from container</>", p.ClientHost, p.ClientPort))
+		} else {
+			parts = append(parts, color.Sprintf("<fg=yellow;op=bold;>%s:%d NOT reachable from container</>", p.ClientHost, p.ClientPort))
+		}
+	}
+	switch {
+	case p.lastRelayError != nil:
+		parts = append(parts, color.Sprintf("<red>connection seen at %s, but the IDE refused it</>", p.lastConnection.Format("15:04:05")))
+	case p.activeConnections > 0:
+		parts = append(parts, color.Sprintf("<green>%d debug connection(s) active</>", p.activeConnections))
+	case !p.lastConnection.IsZero():
+		parts = append(parts, color.Sprintf("<green>last connection seen at %s</>", p.lastConnection.Format("15:04:05")))
+	default:
+		parts = append(parts, "no connection seen yet")
+	}
+	return "Xdebug: " + strings.Join(parts, " | ")
+}
+
+// printStatus redraws the status line on a terminal; otherwise, it prints the status only if it changed.
+func (p *ideProbe) printStatus() {
+	status := p.status()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if stdoutIsTerminal() {
+		// \r and "erase line", so that the status line is updated in place.
+		fmt.Print("\r\033[K" + status)
+	} else if status != p.lastStatus {
+		fmt.Println(status)
+	}
+	p.lastStatus = status
+}
+
+func stdoutIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
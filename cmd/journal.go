@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"os"
+	"path"
+	"time"
+)
+
+// newJournalEntry creates a journal entry for a change made by this drydock invocation.
+func newJournalEntry(tool, action, version string, files ...string) util.JournalEntry {
+	host, _ := os.Hostname()
+	return util.JournalEntry{
+		Tool:           tool,
+		Action:         action,
+		Version:        version,
+		Files:          files,
+		Timestamp:      time.Now().UTC(),
+		DrydockVersion: drydockVersion,
+		Host:           host,
+	}
+}
+
+// journaledScript runs the install/remove script with "set -e", and only appends the entry to the journal of the
+// container (mounted at /container) if the script succeeded. The exit status of the script is kept.
+func journaledScript(script string, entry util.JournalEntry) string {
+	line, _ := json.Marshal(entry)
+	journalFile := "/container" + util.JournalPath
+	return fmt.Sprintf(`
+(
+set -e
+%s
+)
+STATUS=$?
+if [ $STATUS -eq 0 ]; then
+    mkdir -p %s
+    printf '%%s\n' %s >> %s
+fi
+exit $STATUS
+`, script, shellQuote(path.Dir(journalFile)), shellQuote(string(line)), shellQuote(journalFile))
+}
+
+func buildStatusCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "status [SERVICE-or-CONTAINER]",
+		Short: "Show the changes drydock made to the given container",
+		Long: color.Sprintf(`Usage:	drydock status [SERVICE-OR-CONTAINER]
+
+Show the journal of all changes drydock made to the given container, and which files are still installed.
+
+<op=underscore;>Background:</>
+
+    Every command which modifies a container (xdebug, excimer, spx, cleanup) appends an entry to
+    <op=italic;>%s</> inside the container. As the journal lives in the container, it is shared across
+    drydock invocations and machines. <op=italic;>drydock cleanup</> removes the files still listed as installed.
+`, util.JournalPath),
+		Args: cobra.MaximumNArgs(1),
+
+		Run: func(cmd *cobra.Command, args []string) {
+			target := resolveTargetOrExit(targetIdentifierFromArgsOrPick(args))
+
+			runtime := runtimeOrExit()
+			entries, err := util.ReadJournal(runtime, target.ID)
+			if err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
+				os.Exit(1)
+			}
+
+			if len(entries) == 0 {
+				color.Printf("<green>drydock did not change </><fg=green;op=bold;>%s</><green> yet.</>\n", target.Name)
+				return
+			}
+
+			color.Printf("<green>Changes made by drydock to </><fg=green;op=bold;>%s</><green>:</>\n", target.Name)
+			for _, entry := range entries {
+				version := ""
+				if entry.Version != "" {
+					version = " " + entry.Version
+				}
+				color.Printf("  %s  <op=bold;>%s %s%s</>  <gray>(drydock %s on %s)</>\n", entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.Action, entry.Tool, version, entry.DrydockVersion, entry.Host)
+				for _, file := range entry.Files {
+					color.Printf("      %s\n", file)
+				}
+			}
+
+			color.Println("")
+			activeFiles := util.ActiveJournalFiles(entries)
+			if len(activeFiles) == 0 {
+				color.Println("<green>No files installed by drydock are left.</>")
+				return
+			}
+			color.Println("<yellow>Still installed (removed by </><fg=yellow;op=bold;>drydock cleanup</><yellow>):</>")
+			for _, file := range activeFiles {
+				color.Printf("  - %s\n", file)
+			}
+		},
+	}
+
+	return command
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/jonhadfield/findexec"
+	"github.com/sandstorm/drydock/util"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+// kubernetesDebugSession is a node debug pod, entered into the target container.
+type kubernetesDebugSession struct {
+	client   *util.KubernetesClient
+	target   *util.KubernetesTarget
+	debugPod string
+}
+
+// startKubernetesDebugSessionOrExit resolves the pod/NAME[:container] identifier, and starts a privileged debug pod
+// on the node of the target (the Kubernetes equivalent of the CONTAINER_DEBUG helper container).
+func startKubernetesDebugSessionOrExit(identifier string, debugImage string) *kubernetesDebugSession {
+	client, err := util.NewKubernetesClient(kubernetesOptions)
+	if err != nil {
+		color.Printf("<red>FATAL: Could not connect to kubernetes: %s</>\n", err)
+		os.Exit(1)
+	}
+
+	target, err := client.ResolveTarget(identifier)
+	if err != nil {
+		var notRunning *util.TargetNotRunningError
+		if errors.As(err, &notRunning) {
+			color.Printf("<red>FATAL: Container </><fg=red;op=bold;>%s</><fg=red> not running.</>\n", notRunning.Name)
+		} else {
+			color.Printf("<red>FATAL: %s</>\n", err)
+		}
+		os.Exit(1)
+	}
+
+	color.Printf("<green>Starting debug pod on node </><fg=green;op=bold;>%s</><green> for </><fg=green;op=bold;>%s/%s:%s</>\n", target.NodeName, target.Namespace, target.Pod, target.Container)
+	debugPod, err := client.CreateNodeDebugPod(target, debugImage)
+	session := &kubernetesDebugSession{client: client, target: target, debugPod: debugPod}
+	if err != nil {
+		if debugPod != "" {
+			session.delete()
+		}
+		color.Printf("<red>FATAL: %s</>\n", err)
+		os.Exit(1)
+	}
+	return session
+}
+
+// run executes the bash script in the debug pod (with TTY), and returns the exit code of the script.
+func (s *kubernetesDebugSession) run(script string) int {
+	kubectl := findexec.Find("kubectl", "")
+	if kubectl == "" {
+		color.Println("<red>FATAL: kubectl not found in PATH.</>")
+		return 1
+	}
+
+	c := exec.Command(kubectl,
+		"--context", s.client.Context,
+		"--namespace", s.target.Namespace,
+		"exec", "-it", s.debugPod, "-c", "debug", "--",
+		"/bin/bash", "-c", kubernetesEnterScript(s.target.ContainerID)+script,
+	)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	// Ctrl-C is meant for the shell in the pod; we need to survive it to delete the debug pod afterwards.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		color.Printf("<red>FATAL: Could not run kubectl exec: %s</>\n", err)
+		return 1
+	}
+	return 0
+}
+
+// delete removes the debug pod again (like "docker run --rm").
+func (s *kubernetesDebugSession) delete() {
+	if err := s.client.DeleteNodeDebugPod(s.target.Namespace, s.debugPod); err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+	}
+}
+
+// kubernetesEnterScript finds the host PID of the target container in the debug pod, and stores it in $PID. The
+// environment of the container is exported, so that it is available after nsenter (like "--env" for docker).
+//
+// The PID is the process in the cgroup of the container whose parent is outside of it (i.e. the runtime shim).
+func kubernetesEnterScript(containerID string) string {
+	return fmt.Sprintf(`
+CONTAINER_ID=%s
+PID=
+for proc in /proc/[0-9]*; do
+	grep -q "$CONTAINER_ID" "$proc/cgroup" 2>/dev/null || continue
+	PARENT=$(awk '/^PPid:/ { print $2 }' "$proc/status" 2>/dev/null)
+	if ! grep -q "$CONTAINER_ID" "/proc/$PARENT/cgroup" 2>/dev/null; then
+		PID=${proc#/proc/}
+		break
+	fi
+done
+if [ -z "$PID" ]; then
+	echo "ERROR: no process of container $CONTAINER_ID found on this node." >&2
+	exit 1
+fi
+# the PATH of the container may not contain nsenter of the debug image
+NSENTER=$(command -v nsenter)
+while IFS= read -r -d '' variable; do
+	export "$variable"
+done < "/proc/$PID/environ"
+`, shellQuote(containerID))
+}
+
+// kubernetesNsenterCommand is nsenterCommand for the debug pod, where the PID is only known at runtime.
+func kubernetesNsenterCommand(extraArgs ...string) string {
+	args := []string{"exec", `"$NSENTER"`, "--target", `"$PID"`, "--ipc", "--pid", "--net"}
+	for _, arg := range extraArgs {
+		args = append(args, shellQuote(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+// kubernetesExecRoot is execroot for pod/NAME[:container] targets.
+func kubernetesExecRoot(identifier string, debugImage string, noMount bool, command []string) {
+	session := startKubernetesDebugSessionOrExit(identifier, debugImage)
+
+	var script string
+	if noMount {
+		if len(command) > 0 {
+			script = kubernetesNsenterCommand(command...)
+		} else {
+			script = kubernetesNsenterCommand("/bin/bash", "-c", mountSlashContainer+"/bin/bash -l")
+			color.Printf("<op=bold;>-----------------------------------------------------------</>\n")
+			color.Printf("The debugged container file system is mounted in <op=bold;>/container</>\n")
+			color.Printf("<op=bold;>-----------------------------------------------------------</>\n")
+		}
+	} else {
+		if len(command) == 0 {
+			command = []string{"/bin/bash"}
+		}
+		script = kubernetesNsenterCommand(append([]string{"--mount"}, command...)...)
+	}
+
+	exitCode := session.run(script)
+	session.delete()
+	os.Exit(exitCode)
+}
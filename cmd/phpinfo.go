@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+)
+
+// phpProbeScript inspects PHP in the container, and prints key=value lines (see util.ParsePhpRuntime). It runs in
+// the PID namespace of the container, so the running SAPI is detected from /proc.
+const phpProbeScript = mountSlashContainer + `
+PHP_BIN=""
+for dir in /usr/local/bin /usr/local/sbin /usr/bin /usr/sbin; do
+    for file in /container$dir/php /container$dir/php[0-9]* /container$dir/php-fpm* /container$dir/frankenphp /container$dir/rr; do
+        # symlinks (e.g. to /etc/alternatives) point into the container, so we cannot follow them from here.
+        if [ -L "$file" ] || [ -f "$file" ]; then
+            echo "binary=${file#/container}"
+            case "${file##*/}" in
+                php|php[0-9]*) [ -z "$PHP_BIN" ] && PHP_BIN="${file#/container}" ;;
+            esac
+        fi
+    done
+done
+[ -n "$PHP_BIN" ] || exit 0
+echo "php_binary=$PHP_BIN"
+
+chroot /container "$PHP_BIN" -r '
+echo "version=", PHP_VERSION, "\n";
+echo "zts=", PHP_ZTS, "\n";
+echo "extension_dir=", ini_get("extension_dir"), "\n";
+echo "ini_file=", (string) php_ini_loaded_file(), "\n";
+'
+echo "php_api=$(chroot /container "$PHP_BIN" -i 2>/dev/null | sed -n 's/^PHP API => //p')"
+CLI_SCAN_DIR=$(chroot /container "$PHP_BIN" --ini 2>/dev/null | sed -n 's/^Scan for additional .ini files in: *//p')
+echo "cli_ini_scan_dir=$CLI_SCAN_DIR"
+
+SAPI=cli
+SAPI_BIN=""
+for proc in /proc/[0-9]*; do
+    COMM=$(cat $proc/comm 2>/dev/null)
+    [ "$COMM" = supervisord ] && echo "supervisord=1"
+    [ "$SAPI" = cli ] || continue
+    case "$COMM" in
+        frankenphp) SAPI=frankenphp ;;
+        php-fpm*) SAPI=php-fpm ;;
+        apache2|httpd) grep -qE 'libphp|mod_php' $proc/maps 2>/dev/null && SAPI=apache-mod_php ;;
+        rr) SAPI=roadrunner ;;
+        # Swoole servers are plain php processes (or renamed via swoole_set_process_name)
+        *) grep -qE '/(open)?swoole\.so' $proc/maps 2>/dev/null && SAPI=swoole ;;
+    esac
+    [ "$SAPI" = cli ] || SAPI_BIN=$(readlink $proc/exe)
+done
+echo "sapi=$SAPI"
+echo "sapi_binary=$SAPI_BIN"
+
+case "$SAPI" in
+    php-fpm)
+        echo "sapi_ini_scan_dir=$(chroot /container "$SAPI_BIN" -i 2>/dev/null | sed -n 's/^Scan this dir for additional .ini files => //p')"
+        ;;
+    apache-mod_php)
+        # Debian packages: /etc/php/8.2/cli/conf.d -> /etc/php/8.2/apache2/conf.d
+        case "$CLI_SCAN_DIR" in
+            */cli/*) [ -d "/container${CLI_SCAN_DIR/\/cli\//\/apache2\/}" ] && echo "sapi_ini_scan_dir=${CLI_SCAN_DIR/\/cli\//\/apache2\/}" ;;
+        esac
+        ;;
+esac
+
+echo "arch=$(uname -m)"
+if ls /container/lib/ld-musl-* >/dev/null 2>&1; then echo "libc=musl"; else echo "libc=glibc"; fi
+`
+
+// probePhpRuntime runs phpProbeScript in the target. If php.iniDir is configured, ini files are written to its
+// conf.d directory instead of the detected scan dirs; PHP_INI_DIR of the container is the last resort.
+func probePhpRuntime(target *util.Target, debugImage string, config util.Config) (*util.PhpRuntime, error) {
+	c := helperScriptCommand(target, debugImage, phpProbeScript)
+	c.Stderr = os.Stderr
+	output, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not run the PHP probe in %s: %w", target.Name, err)
+	}
+	php, err := util.ParsePhpRuntime(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, target.Name)
+	}
+
+	if config.Php.IniDir != "" {
+		php.IniScanDirs = []string{path.Join(config.Php.IniDir, "conf.d")}
+	} else if len(php.IniScanDirs) == 0 {
+		iniDir, ok := util.LookupEnv(target.Env, "PHP_INI_DIR")
+		if !ok || iniDir == "" {
+			return php, fmt.Errorf("PHP in %s does not scan a directory for additional ini files; please set php.iniDir in .drydock.yaml", target.Name)
+		}
+		php.IniScanDirs = []string{path.Join(iniDir, "conf.d")}
+	}
+	return php, nil
+}
+
+// probePhpRuntimeOrExit probes PHP in the target before anything is installed, and prints a one line summary.
+func probePhpRuntimeOrExit(target *util.Target, debugImage string, config util.Config) *util.PhpRuntime {
+	php, err := probePhpRuntime(target, debugImage, config)
+	if err != nil {
+		color.Printf("<red>FATAL: %s</>\n", err)
+		os.Exit(1)
+	}
+	color.Printf("<green>Found </><fg=green;op=bold;>PHP %s</><green> (%s, %s) - ini files go to %s</>\n", php.Version, php.Sapi, php.BuildKey(), strings.Join(php.IniScanDirs, ", "))
+	return php
+}
+
+// phpIniWriteScript writes content to all given ini files in the container (mounted at /container).
+func phpIniWriteScript(iniFiles []string, content string) string {
+	var quotedFiles []string
+	for _, file := range iniFiles {
+		quotedFiles = append(quotedFiles, shellQuote("/container"+file))
+	}
+	return `
+cat << 'EOF' | tee ` + strings.Join(quotedFiles, " ") + ` > /dev/null
+` + content + `EOF
+`
+}
+
+// phpIniRemoveScript removes the given ini files from the container (mounted at /container).
+func phpIniRemoveScript(iniFiles []string) string {
+	var quotedFiles []string
+	for _, file := range iniFiles {
+		quotedFiles = append(quotedFiles, shellQuote("/container"+file))
+	}
+	return `
+rm -f ` + strings.Join(quotedFiles, " ") + `
+`
+}
+
+func buildPhpInfoCommand() *cobra.Command {
+	var debugImage string = "nicolaka/netshoot"
+	var format string
+
+	var command = &cobra.Command{
+		Use:   "php-info [flags] [SERVICE-or-CONTAINER]",
+		Short: "Show which PHP runs in the given container, as detected by the PHP commands",
+		Long: color.Sprintf(`Usage:	drydock php-info [flags] [SERVICE-OR-CONTAINER]
+
+Inspect PHP in the given container, the same way <op=italic;>drydock xdebug</>, <op=italic;>excimer</> and <op=italic;>spx</> do before they
+install anything: PHP binaries, version, ZTS/NTS, extension_dir, the directories scanned for additional ini
+files, and the SAPI serving requests (php-fpm, Apache mod_php, FrankenPHP, RoadRunner, or only the CLI).
+
+<op=underscore;>Options:</>
+      --format               Output format: "table" (default) or "json"
+      --debug-image          What debugger docker image to use for executing nsenter.
+                             By default, nicolaka/netshoot is used
+
+<op=underscore;>Examples</>
+
+<op=bold;>Where would drydock xdebug write its ini file?</>
+	drydock php-info <op=italic;>my-docker-compose-service</>
+
+<op=bold;>Script against the result</>
+	drydock php-info --format json <op=italic;>myContainer</> | jq -r .extensionDir
+`),
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown format %s - must be table or json", format)
+			}
+
+			target := resolveTargetOrExit(targetIdentifierFromArgsOrPick(args))
+			config := loadConfigOrExit(target)
+			debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
+
+			php, err := probePhpRuntime(target, debugImage, config)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				res, err := json.MarshalIndent(php, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(res))
+				return nil
+			}
+
+			threadSafety := "NTS"
+			if php.Zts {
+				threadSafety = "ZTS"
+			}
+			sapi := php.Sapi
+			if php.SapiBinary != "" {
+				sapi += " (" + php.SapiBinary + ")"
+			}
+			if php.Supervisord {
+				sapi += ", supervisord"
+			}
+			iniFile := php.IniFile
+			if iniFile == "" {
+				iniFile = "(none)"
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(w, "Container\t%s\n", target.Name)
+			fmt.Fprintf(w, "PHP\t%s (API %s, %s)\n", php.Version, php.Api, threadSafety)
+			fmt.Fprintf(w, "CLI binary\t%s\n", php.Binary)
+			fmt.Fprintf(w, "Binaries\t%s\n", strings.Join(php.Binaries, ", "))
+			fmt.Fprintf(w, "SAPI\t%s\n", sapi)
+			reloadStrategy, _ := phpReloadOptionsFromConfig(config).resolve(php)
+			fmt.Fprintf(w, "Reload\t%s - %s\n", reloadStrategy.Name, reloadStrategy.Description)
+			fmt.Fprintf(w, "php.ini\t%s\n", iniFile)
+			fmt.Fprintf(w, "Ini scan dirs\t%s\n", strings.Join(php.IniScanDirs, ", "))
+			fmt.Fprintf(w, "extension_dir\t%s\n", php.ExtensionDir)
+			fmt.Fprintf(w, "Platform\t%s, %s\n", php.Arch, php.Libc)
+			fmt.Fprintf(w, "Extension cache key\t%s\n", php.BuildKey())
+			fmt.Fprintf(w, "Known-good versions\t%s\n", strings.Join(knownGoodPhpExtensionVersions(php), ", "))
+			return w.Flush()
+		},
+	}
+
+	command.Flags().StringVar(&format, "format", "table", "Output format: table or json")
+	command.Flags().StringVarP(&debugImage, "debug-image", "", "nicolaka/netshoot", "What debugger docker image to use for executing nsenter. By default, nicolaka/netshoot is used")
+
+	return command
+}
+
+// knownGoodPhpExtensionVersions lists the versions from the compatibility matrix which xdebug, spx and excimer would
+// install into this PHP runtime.
+func knownGoodPhpExtensionVersions(php *util.PhpRuntime) []string {
+	versions := util.DefaultPhpExtensionVersions()
+	var result []string
+	for _, extension := range []string{"xdebug", "spx", "excimer"} {
+		version, ok := versions.For(extension, php.MinorVersion())
+		if !ok {
+			version = util.PhpExtensionVersionLatest
+		}
+		result = append(result, extension+" "+version)
+	}
+	return result
+}
@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// phpReloadAuto chooses the reload strategy from the SAPI detected by the PHP probe.
+const phpReloadAuto = "auto"
+
+// phpReloadStrategy makes PHP pick up changed ini files (and newly installed extensions).
+type phpReloadStrategy struct {
+	Name        string
+	Description string
+	// Script runs in the helper container; the container is mounted at /container, and its PID and network
+	// namespaces are entered (e.g. for admin APIs listening on localhost).
+	Script func(php *util.PhpRuntime) string
+}
+
+var phpReloadStrategies = []phpReloadStrategy{
+	{
+		Name:        "php-fpm",
+		Description: "graceful reload of php-fpm (kill -USR2)",
+		Script: func(php *util.PhpRuntime) string {
+			return `pkill -USR2 php-fpm`
+		},
+	},
+	{
+		Name:        "apache",
+		Description: "graceful restart of Apache with mod_php (kill -USR1)",
+		Script: func(php *util.PhpRuntime) string {
+			// the oldest process is the parent, which restarts its children gracefully.
+			return `pkill -USR1 -o -x 'apache2|httpd'`
+		},
+	},
+	{
+		Name:        "frankenphp",
+		Description: "reload via the Caddy admin API of FrankenPHP (localhost:2019), which restarts PHP",
+		Script: func(php *util.PhpRuntime) string {
+			// "Cache-Control: must-revalidate" forces the reload, although the config did not change.
+			return `CADDY_CONFIG=$(curl -sSf http://localhost:2019/config/) && \
+    curl -sSf -X POST -H "Content-Type: application/json" -H "Cache-Control: must-revalidate" \
+        --data "$CADDY_CONFIG" http://localhost:2019/load`
+		},
+	},
+	{
+		Name:        "roadrunner",
+		Description: "rr reset, in the working directory of the RoadRunner server (restarts the PHP workers)",
+		Script: func(php *util.PhpRuntime) string {
+			return `RR_PID=$(pgrep -o -x rr)
+RR_BIN=$(readlink /proc/$RR_PID/exe)
+RR_DIR=$(readlink /proc/$RR_PID/cwd)
+chroot /container "$RR_BIN" reset -w "$RR_DIR"`
+		},
+	},
+	{
+		Name:        "supervisord",
+		Description: "restart all supervisord programs (supervisorctl restart all)",
+		Script: func(php *util.PhpRuntime) string {
+			return `chroot /container supervisorctl restart all`
+		},
+	},
+	{
+		Name:        "none",
+		Description: "do not reload PHP",
+		Script: func(php *util.PhpRuntime) string {
+			return `true`
+		},
+	},
+}
+
+// phpReloadStrategyNames are the values of --reload, for the help texts.
+func phpReloadStrategyNames() []string {
+	names := []string{phpReloadAuto}
+	for _, strategy := range phpReloadStrategies {
+		names = append(names, strategy.Name)
+	}
+	return names
+}
+
+// phpReloadStrategyForSapi is the strategy chosen by "auto".
+func phpReloadStrategyForSapi(php *util.PhpRuntime) string {
+	switch php.Sapi {
+	case util.PhpSapiFpm:
+		return "php-fpm"
+	case util.PhpSapiApache:
+		return "apache"
+	case util.PhpSapiFrankenPhp:
+		return "frankenphp"
+	case util.PhpSapiRoadRunner:
+		return "roadrunner"
+	case util.PhpSapiSwoole:
+		// there is nothing to reload: see the warning in reloadPhp.
+		return "none"
+	}
+	if php.Supervisord {
+		// a CLI container with supervisord usually runs PHP workers under it.
+		return "supervisord"
+	}
+	return "none"
+}
+
+// phpReloadOptions is how PHP is reloaded after the ini files changed.
+type phpReloadOptions struct {
+	// Strategy is one of phpReloadStrategies, or phpReloadAuto.
+	Strategy string
+	// Command is the custom php.reloadCommand; if set, it is run instead of the strategy.
+	Command string
+	// RestartWorkers is a regular expression for long-running PHP CLI workers which are restarted in addition
+	// (supervisord programs by name, otherwise processes by command line).
+	RestartWorkers string
+}
+
+// addPhpReloadFlags adds --reload and --restart-workers to a PHP command.
+func addPhpReloadFlags(command *cobra.Command, options *phpReloadOptions) {
+	command.Flags().StringVar(&options.Strategy, "reload", phpReloadAuto, "How to reload PHP afterwards: "+strings.Join(phpReloadStrategyNames(), ", "))
+	command.Flags().StringVar(&options.RestartWorkers, "restart-workers", "", "Regular expression for PHP CLI workers to restart as well (supervisord program names, or process command lines)")
+}
+
+// phpReloadOptionsFromFlagsOrConfig merges the flags of addPhpReloadFlags with the php section of the config.
+func phpReloadOptionsFromFlagsOrConfig(cmd *cobra.Command, options phpReloadOptions, config util.Config) phpReloadOptions {
+	options.Strategy = stringFlagOrConfig(cmd, "reload", options.Strategy, config.Php.Reload)
+	options.RestartWorkers = stringFlagOrConfig(cmd, "restart-workers", options.RestartWorkers, config.Php.RestartWorkers)
+	if !cmd.Flags().Changed("reload") {
+		// an explicit --reload wins over a configured reloadCommand.
+		options.Command = config.Php.ReloadCommand
+	}
+	return options
+}
+
+// phpReloadOptionsFromConfig are the reload options of commands without reload flags (e.g. cleanup).
+func phpReloadOptionsFromConfig(config util.Config) phpReloadOptions {
+	options := phpReloadOptions{
+		Strategy:       config.Php.Reload,
+		Command:        config.Php.ReloadCommand,
+		RestartWorkers: config.Php.RestartWorkers,
+	}
+	if options.Strategy == "" {
+		options.Strategy = phpReloadAuto
+	}
+	return options
+}
+
+// validate checks the strategy name, before anything is installed.
+func (o phpReloadOptions) validate() error {
+	if o.Strategy != phpReloadAuto && o.strategy(o.Strategy) == nil {
+		return fmt.Errorf("unknown reload strategy %q - must be one of %s", o.Strategy, strings.Join(phpReloadStrategyNames(), ", "))
+	}
+	return nil
+}
+
+func (o phpReloadOptions) strategy(name string) *phpReloadStrategy {
+	for i := range phpReloadStrategies {
+		if phpReloadStrategies[i].Name == name {
+			return &phpReloadStrategies[i]
+		}
+	}
+	return nil
+}
+
+// resolve returns the strategy to use for the given PHP runtime, and its script.
+func (o phpReloadOptions) resolve(php *util.PhpRuntime) (phpReloadStrategy, string) {
+	if o.Command != "" {
+		return phpReloadStrategy{Name: "reloadCommand", Description: o.Command}, o.Command
+	}
+	name := o.Strategy
+	if name == phpReloadAuto {
+		name = phpReloadStrategyForSapi(php)
+	}
+	strategy := o.strategy(name)
+	return *strategy, strategy.Script(php)
+}
+
+// phpContainerProcessFunctions are shell functions to find processes of the container; our own helper processes
+// are in the same PID namespace, but have a different root directory.
+const phpContainerProcessFunctions = `
+CONTAINER_ROOT=$(stat -L -c %d:%i /proc/1/root/)
+# container_pids REGEX: PIDs of container processes whose command line matches
+container_pids() {
+    for proc in /proc/[0-9]*; do
+        [ "$(stat -L -c %d:%i $proc/root/ 2>/dev/null)" = "$CONTAINER_ROOT" ] || continue
+        tr '\0' ' ' < $proc/cmdline 2>/dev/null | grep -qE -- "$1" && echo "${proc#/proc/}"
+    done
+}
+# container_pids_by_name REGEX: PIDs of container processes whose name (comm) matches
+container_pids_by_name() {
+    for proc in /proc/[0-9]*; do
+        [ "$(stat -L -c %d:%i $proc/root/ 2>/dev/null)" = "$CONTAINER_ROOT" ] || continue
+        grep -qE -- "$1" $proc/comm 2>/dev/null && echo "${proc#/proc/}"
+    done
+}
+`
+
+// phpRestartWorkersScript restarts the supervisord programs whose name matches the pattern; without supervisord,
+// the matching processes are terminated, expecting their process manager to start them again.
+func phpRestartWorkersScript(pattern string) string {
+	return phpContainerProcessFunctions + `
+PATTERN=` + shellQuote(pattern) + `
+PROGRAMS=""
+if pgrep -x supervisord > /dev/null; then
+    PROGRAMS=$(chroot /container supervisorctl status 2>/dev/null | awk '{print $1}' | grep -E -- "$PATTERN")
+fi
+if [ -n "$PROGRAMS" ]; then
+    echo "restarting supervisord programs:" $PROGRAMS
+    chroot /container supervisorctl restart $PROGRAMS
+else
+    PIDS=$(container_pids "$PATTERN")
+    if [ -z "$PIDS" ]; then
+        echo "!!!! no worker matches $PATTERN"
+    fi
+    for pid in $PIDS; do
+        if [ "$pid" = 1 ]; then
+            echo "!!!! not terminating PID 1 ($(tr '\0' ' ' < /proc/1/cmdline)) - that would stop the container"
+            continue
+        fi
+        echo "terminating worker $pid: $(tr '\0' ' ' < /proc/$pid/cmdline)"
+        kill -TERM $pid
+    done
+    if [ -n "$PIDS" ]; then
+        echo "the workers need to be started again by their process manager"
+    fi
+fi
+`
+}
+
+// reloadPhp runs the reload strategy (and restarts the workers) in the target.
+func reloadPhp(target *util.Target, debugImage string, php *util.PhpRuntime, options phpReloadOptions) error {
+	strategy, script := options.resolve(php)
+	color.Printf("<green>Reloading PHP: </><fg=green;op=bold;>%s</><green> - %s</>\n", strategy.Name, strategy.Description)
+	if strategy.Name == "none" && options.RestartWorkers == "" && php.Sapi == util.PhpSapiCli {
+		color.Println("<fg=yellow>No PHP server found in the container; restart long-running PHP workers with --restart-workers.</>")
+	}
+	if php.Sapi == util.PhpSapiSwoole && options.RestartWorkers == "" {
+		// kill -USR1 to the master only restarts the workers; they are forked from the manager process, and thus
+		// inherit its loaded extensions.
+		color.Println("<fg=yellow>Swoole server found: it only loads new extensions when it is started again - restart it with --restart-workers (e.g. the command line of the server script).</>")
+	}
+
+	script = mountSlashContainer + "\n" + script + "\n"
+	if options.RestartWorkers != "" {
+		script += phpRestartWorkersScript(options.RestartWorkers)
+	}
+
+	dockerRunCommand := dockerRunNsenterCommand(target, debugImage, util.EnvCliCallsForDockerRun(target.Env))
+	dockerRunCommand = append(dockerRunCommand, "--net", "/bin/bash", "-c", script)
+	c := exec.Command(runtimeExecutableOrExit(), dockerRunCommand[1:]...)
+	c.Env = os.Environ()
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("reloading PHP (%s) failed: %w", strategy.Name, err)
+	}
+	return nil
+}
+
+// phpWorkerContext is the process whose environment is used to check which extensions PHP loads.
+func phpWorkerContext(php *util.PhpRuntime, options phpReloadOptions) (selector string, binary string) {
+	binary = php.Binary
+	switch {
+	case options.RestartWorkers != "":
+		return `container_pids ` + shellQuote(options.RestartWorkers), binary
+	case php.Sapi == util.PhpSapiFpm && php.SapiBinary != "":
+		// php-fpm -m lists the modules of the FPM SAPI, with its own ini scan dir.
+		return `container_pids_by_name '^php-fpm'`, php.SapiBinary
+	case php.Sapi == util.PhpSapiApache:
+		return `container_pids_by_name '^(apache2|httpd)$'`, binary
+	case php.Sapi == util.PhpSapiFrankenPhp:
+		return `container_pids_by_name '^frankenphp$'`, binary
+	case php.Sapi == util.PhpSapiRoadRunner:
+		// the PHP workers of RoadRunner
+		return `container_pids_by_name '^php'`, binary
+	}
+	return `echo 1`, binary
+}
+
+// phpReloadOptionsHelp documents addPhpReloadFlags in the Long help of the PHP commands.
+const phpReloadOptionsHelp = `      --reload               How to reload PHP: auto (default, chosen from the detected SAPI), php-fpm, apache,
+                             frankenphp, roadrunner, supervisord or none
+      --restart-workers      Regular expression for long-running PHP CLI workers (e.g. job queues) to restart
+                             as well: supervisord program names, or process command lines`
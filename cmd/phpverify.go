@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// phpCheck is one step of the post-install verification; Skipped explains why it was not checked.
+type phpCheck struct {
+	Title   string
+	Detail  string
+	Err     error
+	Skipped string
+}
+
+// phpChecklist is printed after an extension was installed, so that it is obvious which step failed.
+type phpChecklist []phpCheck
+
+func (c phpChecklist) print() {
+	color.Println("")
+	for _, check := range c {
+		switch {
+		case check.Err != nil:
+			color.Printf("  <red>✘ %s</>: %s\n", check.Title, check.Err)
+		case check.Skipped != "":
+			color.Printf("  <gray>- %s (skipped: %s)</>\n", check.Title, check.Skipped)
+		case check.Detail != "":
+			color.Printf("  <green>✔ %s</> <gray>%s</>\n", check.Title, check.Detail)
+		default:
+			color.Printf("  <green>✔ %s</>\n", check.Title)
+		}
+	}
+	color.Println("")
+}
+
+func (c phpChecklist) failed() bool {
+	for _, check := range c {
+		if check.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// activatePhpExtension reloads PHP after the ini files of the extension were written, and verifies that it is
+// active: the .so exists in extension_dir, php -m lists the module, and the php-fpm workers were restarted. The
+// checklist is printed; false is returned if any check failed.
+func activatePhpExtension(target *util.Target, debugImage string, php *util.PhpRuntime, options phpReloadOptions, module string) bool {
+	soFile := path.Join(php.ExtensionDir, module+".so")
+	var checklist phpChecklist
+
+	exists, err := runtimeOrExit().PathExists(target.ID, soFile)
+	if err == nil && !exists {
+		err = fmt.Errorf("%s does not exist", soFile)
+	}
+	checklist = append(checklist, phpCheck{Title: module + ".so exists in extension_dir", Detail: soFile, Err: err})
+
+	// the workers before the reload, to see whether they were replaced.
+	var workersBefore []int
+	if php.Sapi == util.PhpSapiFpm {
+		workersBefore, _ = phpFpmWorkerPids(target, debugImage)
+	}
+
+	err = reloadPhp(target, debugImage, php, options)
+	strategy, _ := options.resolve(php)
+	checklist = append(checklist, phpCheck{Title: "PHP reloaded", Detail: strategy.Name, Err: err})
+
+	detail, err := verifyPhpExtensionLoaded(target, debugImage, php, options, module)
+	checklist = append(checklist, phpCheck{Title: "php -m lists " + module, Detail: detail, Err: err})
+
+	checklist = append(checklist, checkPhpFpmWorkersRestarted(target, debugImage, php, strategy.Name, workersBefore))
+
+	checklist.print()
+	return !checklist.failed()
+}
+
+// verifyPhpExtensionLoaded runs "php -m" with the environment of a running PHP worker (e.g. PHP_INI_SCAN_DIR), and
+// checks that the module is listed.
+func verifyPhpExtensionLoaded(target *util.Target, debugImage string, php *util.PhpRuntime, options phpReloadOptions, module string) (string, error) {
+	selector, binary := phpWorkerContext(php, options)
+	script := mountSlashContainer + phpContainerProcessFunctions + `
+# give the reload (and supervisord) a moment to start the new processes
+sleep 2
+PID=$(` + selector + ` | sort -n | head -n 1)
+[ -n "$PID" ] || PID=1
+echo "worker=$PID $(tr '\0' ' ' < /proc/$PID/cmdline)"
+WORKER_ENV=()
+while IFS= read -r -d '' entry; do WORKER_ENV+=("$entry"); done < /proc/$PID/environ
+env -i "${WORKER_ENV[@]}" "$(command -v chroot)" /container ` + shellQuote(binary) + ` -m
+`
+	c := helperScriptCommand(target, debugImage, script)
+	c.Stderr = os.Stderr
+	output, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not run %s -m in the container: %w", binary, err)
+	}
+
+	worker := ""
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if value, ok := strings.CutPrefix(line, "worker="); ok {
+			worker = value
+			continue
+		}
+		if strings.EqualFold(line, module) {
+			return fmt.Sprintf("%s -m, in the context of PID %s", binary, worker), nil
+		}
+	}
+	return "", fmt.Errorf("%s -m in the context of PID %s does not list it", binary, worker)
+}
+
+// phpFpmWorkerPids returns the PIDs of the php-fpm pool workers (the children of the php-fpm master).
+func phpFpmWorkerPids(target *util.Target, debugImage string) ([]int, error) {
+	script := mountSlashContainer + phpContainerProcessFunctions + `
+for pid in $(container_pids_by_name '^php-fpm'); do
+    echo "$pid $(awk '/^PPid:/ { print $2 }' /proc/$pid/status)"
+done
+`
+	output, err := helperScriptCommand(target, debugImage, script).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the php-fpm processes: %w", err)
+	}
+
+	parents := map[int]int{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		ppid, _ := strconv.Atoi(fields[1])
+		parents[pid] = ppid
+	}
+	var workers []int
+	for pid, ppid := range parents {
+		if _, parentIsFpm := parents[ppid]; parentIsFpm {
+			workers = append(workers, pid)
+		}
+	}
+	slices.Sort(workers)
+	return workers, nil
+}
+
+// checkPhpFpmWorkersRestarted checks that none of the php-fpm workers from before the reload is still running, as
+// they would still run without the extension.
+func checkPhpFpmWorkersRestarted(target *util.Target, debugImage string, php *util.PhpRuntime, strategy string, workersBefore []int) phpCheck {
+	check := phpCheck{Title: "php-fpm workers restarted"}
+	switch {
+	case php.Sapi != util.PhpSapiFpm:
+		check.Skipped = "no php-fpm"
+		return check
+	case strategy == "none":
+		check.Skipped = "--reload none"
+		return check
+	case len(workersBefore) == 0:
+		check.Skipped = "no workers were running before (pm = ondemand?)"
+		return check
+	}
+
+	workersAfter, err := phpFpmWorkerPids(target, debugImage)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	for _, pid := range workersBefore {
+		if slices.Contains(workersAfter, pid) {
+			check.Err = fmt.Errorf("worker PID %d is still running (PIDs before: %s, after: %s)", pid, formatPids(workersBefore), formatPids(workersAfter))
+			return check
+		}
+	}
+	check.Detail = fmt.Sprintf("PIDs %s -> %s", formatPids(workersBefore), formatPids(workersAfter))
+	return check
+}
+
+func formatPids(pids []int) string {
+	if len(pids) == 0 {
+		return "(none)"
+	}
+	var result []string
+	for _, pid := range pids {
+		result = append(result, strconv.Itoa(pid))
+	}
+	return strings.Join(result, ", ")
+}
+
+// revertPhpExtensionAndExit runs the deactivate script (removing the ini files again), reloads PHP and exits with
+// a non-zero exit code; used if the extension could not be activated.
+func revertPhpExtensionAndExit(target *util.Target, debugImage string, php *util.PhpRuntime, options phpReloadOptions, name string, deactivateScript string) {
+	color.Printf("<red>FATAL: %s could not be activated - removing it again.</>\n", name)
+	if err := runHelperScript(target, debugImage, deactivateScript); err != nil {
+		color.Printf("<red>ERROR: removing %s failed: %s</>\n", name, err)
+	} else if err := reloadPhp(target, debugImage, php, options); err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+	}
+	os.Exit(1)
+}
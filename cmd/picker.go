@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"golang.org/x/term"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// pickerVisibleRows is the maximum number of containers shown at once in the picker.
+const pickerVisibleRows = 12
+
+var errPickerAborted = errors.New("aborted by user")
+
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// targetIdentifierFromArgsOrPick returns the SERVICE-or-CONTAINER argument; or, if none was given, lets the user
+// choose one of the running containers. The result is then fed into the normal resolution (resolveTargetOrExit).
+func targetIdentifierFromArgsOrPick(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	if !stdinIsTerminal() {
+		color.Println("<red>FATAL: No SERVICE-or-CONTAINER given, and stdin is not a terminal to choose one interactively.</>")
+		color.Println("")
+		os.Exit(1)
+	}
+
+	runtime := runtimeOrExit()
+	containers, err := runtime.ListContainers(false, nil)
+	if err != nil {
+		color.Printf("<red>FATAL: Could not list containers: %s</>\n", err)
+		os.Exit(1)
+	}
+
+	var candidates []util.ContainerSummary
+	for _, container := range containers {
+		// our own debug sidecars are not interesting to debug
+		if !strings.HasSuffix(container.Name, "_DEBUG") {
+			candidates = append(candidates, container)
+		}
+	}
+	if len(candidates) == 0 {
+		color.Println("<red>FATAL: No running containers found.</>")
+		os.Exit(1)
+	}
+
+	selected, err := pickContainer("Choose a container (type to filter, Enter to select, Esc to abort)", candidates)
+	if err != nil {
+		color.Printf("<red>FATAL: No container selected: %s</>\n", err)
+		os.Exit(1)
+	}
+	return selected.Name
+}
+
+// pickReplica asks the user which replica of a scaled compose service should be used.
+func pickReplica(identifier string, candidates []util.ContainerSummary) (*util.ContainerSummary, error) {
+	return pickContainer(fmt.Sprintf("docker compose service %s has %d running replicas - which one should be used?", identifier, len(candidates)), candidates)
+}
+
+type pickerEntry struct {
+	container util.ContainerSummary
+	line      string
+}
+
+// pickContainer shows a fuzzy-searchable list of the given containers in the terminal and returns the chosen one.
+func pickContainer(title string, candidates []util.ContainerSummary) (*util.ContainerSummary, error) {
+	entries := buildPickerEntries(candidates)
+
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("could not switch terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	query := ""
+	selectedRow := 0
+	renderedLines := 0
+	buf := make([]byte, 16)
+
+	for {
+		matches := filterPickerEntries(entries, query)
+		if selectedRow >= len(matches) {
+			selectedRow = max(len(matches)-1, 0)
+		}
+		renderedLines = renderPicker(title, query, matches, selectedRow, renderedLines)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		key := buf[:n]
+
+		switch {
+		case key[0] == 3 || (n == 1 && key[0] == 27): // Ctrl-C, Esc
+			clearPicker(renderedLines)
+			return nil, errPickerAborted
+		case key[0] == '\r' || key[0] == '\n':
+			clearPicker(renderedLines)
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no container matches %q", query)
+			}
+			return &matches[selectedRow].container, nil
+		case key[0] == 127 || key[0] == 8: // Backspace
+			if len(query) > 0 {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+			}
+		case string(key) == "\x1b[A" || key[0] == 16: // Up, Ctrl-P
+			if selectedRow > 0 {
+				selectedRow--
+			}
+		case string(key) == "\x1b[B" || key[0] == 14: // Down, Ctrl-N
+			if selectedRow < len(matches)-1 {
+				selectedRow++
+			}
+		case key[0] >= 32 && key[0] != 127:
+			query += string(key)
+			selectedRow = 0
+		}
+	}
+}
+
+func buildPickerEntries(candidates []util.ContainerSummary) []pickerEntry {
+	rows := make([][]string, 0, len(candidates))
+	widths := make([]int, 4)
+	for _, candidate := range candidates {
+		composeName := ""
+		if project := candidate.Labels["com.docker.compose.project"]; project != "" {
+			composeName = project + "/" + candidate.Labels["com.docker.compose.service"]
+		}
+		row := []string{candidate.Name, candidate.Image, composeName, candidate.Status}
+		for i, column := range row {
+			widths[i] = max(widths[i], min(utf8.RuneCountInString(column), 40))
+		}
+		rows = append(rows, row)
+	}
+
+	entries := make([]pickerEntry, 0, len(candidates))
+	for i, row := range rows {
+		var line strings.Builder
+		for j, column := range row {
+			// truncated by runes (not bytes), so that no multi-byte character is cut in half; fmt pads by runes as well.
+			if runes := []rune(column); len(runes) > 40 {
+				column = string(runes[:39]) + "…"
+			}
+			fmt.Fprintf(&line, "%-*s  ", widths[j], column)
+		}
+		entries = append(entries, pickerEntry{container: candidates[i], line: strings.TrimRight(line.String(), " ")})
+	}
+	return entries
+}
+
+// filterPickerEntries returns all entries matching the query as (case-insensitive) subsequence; best matches first.
+func filterPickerEntries(entries []pickerEntry, query string) []pickerEntry {
+	type scored struct {
+		entry pickerEntry
+		score int
+	}
+	var matches []scored
+	for _, entry := range entries {
+		if score, ok := fuzzyScore(strings.ToLower(entry.line), strings.ToLower(query)); ok {
+			matches = append(matches, scored{entry, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	result := make([]pickerEntry, 0, len(matches))
+	for _, match := range matches {
+		result = append(result, match.entry)
+	}
+	return result
+}
+
+// fuzzyScore checks whether all characters of query appear in order in text. Consecutive matches and matches
+// near the start score higher.
+func fuzzyScore(text, query string) (int, bool) {
+	score := 0
+	textPos := 0
+	previousMatch := -2
+	for _, r := range query {
+		idx := strings.IndexRune(text[textPos:], r)
+		if idx < 0 {
+			return 0, false
+		}
+		matchPos := textPos + idx
+		if matchPos == previousMatch+1 {
+			score += 5
+		}
+		score -= idx
+		previousMatch = matchPos
+		textPos = matchPos + utf8.RuneLen(r)
+	}
+	return score, true
+}
+
+// renderPicker draws the picker below the cursor, after erasing the previously drawn lines. In raw mode, we need
+// explicit carriage returns.
+func renderPicker(title, query string, matches []pickerEntry, selectedRow, previouslyRenderedLines int) int {
+	var out strings.Builder
+	if previouslyRenderedLines > 0 {
+		fmt.Fprintf(&out, "\x1b[%dA", previouslyRenderedLines)
+	}
+	out.WriteString("\r\x1b[J")
+	out.WriteString(color.Sprintf("<green>%s</>\r\n", title))
+
+	firstRow := 0
+	if selectedRow >= pickerVisibleRows {
+		firstRow = selectedRow - pickerVisibleRows + 1
+	}
+	lines := 1
+	for i := firstRow; i < len(matches) && i < firstRow+pickerVisibleRows; i++ {
+		if i == selectedRow {
+			out.WriteString(color.Sprintf("<op=reverse;>> %s</>\r\n", matches[i].line))
+		} else {
+			out.WriteString("  " + matches[i].line + "\r\n")
+		}
+		lines++
+	}
+	if len(matches) == 0 {
+		out.WriteString(color.Sprintf("<gray>  no matching containers</>\r\n"))
+		lines++
+	}
+	out.WriteString(color.Sprintf("<op=bold;>> </>%s", query))
+
+	os.Stdout.WriteString(out.String())
+	return lines
+}
+
+func clearPicker(renderedLines int) {
+	fmt.Fprintf(os.Stdout, "\x1b[%dA\r\x1b[J", renderedLines)
+}
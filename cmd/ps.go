@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"github.com/spf13/cobra"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultPhpIniDir is PHP_INI_DIR of the official PHP docker images; used if the container does not define it.
+const defaultPhpIniDir = "/usr/local/etc/php"
+
+// phpToolIniFiles are the conf.d files written by the PHP commands; if they exist, the tool is active.
+var phpToolIniFiles = []struct {
+	Tool    string
+	IniFile string
+}{
+	{"xdebug", "xdebug.ini"},
+	{"excimer", "excimer.ini"},
+	{"spx", "spx.ini"},
+}
+
+// phpIniDirOf returns the PHP_INI_DIR of the given container environment.
+func phpIniDirOf(env []string) string {
+	if iniDir, ok := util.LookupEnv(env, "PHP_INI_DIR"); ok && iniDir != "" {
+		return iniDir
+	}
+	return defaultPhpIniDir
+}
+
+// phpConfDPath returns the path of the given ini file in the conf.d directory of the container.
+func phpConfDPath(env []string, iniFile string) string {
+	return path.Join(phpIniDirOf(env), "conf.d", iniFile)
+}
+
+// phpToolIniPaths are the paths where the given ini file may have been written, without probing PHP: the ones
+// recorded as installed in the journal (the scan dirs found by the PHP probe, e.g. /etc/php/8.2/fpm/conf.d), and the
+// conf.d of PHP_INI_DIR, for installations which predate the journal.
+func phpToolIniPaths(env []string, journalEntries []util.JournalEntry, iniFile string) []string {
+	var paths []string
+	for _, file := range util.ActiveJournalFiles(journalEntries) {
+		if path.Base(file) == iniFile {
+			paths = append(paths, file)
+		}
+	}
+	if confDPath := phpConfDPath(env, iniFile); !slices.Contains(paths, confDPath) {
+		paths = append(paths, confDPath)
+	}
+	return paths
+}
+
+type psEntry struct {
+	Name           string   `json:"name"`
+	ID             string   `json:"id"`
+	Image          string   `json:"image"`
+	ComposeProject string   `json:"composeProject,omitempty"`
+	ComposeService string   `json:"composeService,omitempty"`
+	Pid            int      `json:"pid"`
+	DebugSidecar   bool     `json:"debugSidecar"`
+	XdebugRelay    bool     `json:"xdebugRelay"`
+	PhpTools       []string `json:"phpTools"`
+}
+
+func buildPsCommand() *cobra.Command {
+	var format string
+
+	var command = &cobra.Command{
+		Use:   "ps [flags]",
+		Short: "List running containers and the drydock tools active in them",
+		Long: color.Sprintf(`Usage:	drydock ps [flags]
+
+List running containers together with their docker compose service, host PID and the drydock tools
+which are currently active in them.
+
+<op=underscore;>Options:</>
+      --format               Output format: "table" (default) or "json"
+
+<op=underscore;>Examples</>
+
+<op=bold;>Show all running containers</>
+	drydock ps
+
+<op=bold;>Script against the list of containers</>
+	drydock ps --format json | jq '.[] | select(.phpTools | index("xdebug")) | .name'
+
+<op=underscore;>Background:</>
+
+    A container has an active <op=italic;>debug sidecar</> if a <op=italic;>CONTAINER_DEBUG</> container (started by execroot, vscode,
+    xdebug, ...) is running. PHP tools are active if their ini file exists where the drydock journal recorded it
+    (the ini scan dirs found by the PHP probe), or in <op=italic;>$PHP_INI_DIR/conf.d</>.
+`),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown format %s - must be table or json", format)
+			}
+
+			entries, err := collectPsEntries()
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				res, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(res))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "CONTAINER\tSERVICE\tPID\tDRYDOCK")
+			for _, entry := range entries {
+				service := "-"
+				if entry.ComposeService != "" {
+					service = entry.ComposeProject + "/" + entry.ComposeService
+				}
+				var active []string
+				if entry.DebugSidecar {
+					active = append(active, "debug-sidecar")
+				}
+				if entry.XdebugRelay {
+					active = append(active, "xdebug-relay")
+				}
+				active = append(active, entry.PhpTools...)
+				if len(active) == 0 {
+					active = []string{"-"}
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", entry.Name, service, entry.Pid, strings.Join(active, ", "))
+			}
+			return w.Flush()
+		},
+	}
+
+	command.Flags().StringVar(&format, "format", "table", "Output format: table or json")
+
+	return command
+}
+
+func collectPsEntries() ([]psEntry, error) {
+	runtime := runtimeOrExit()
+	containers, err := runtime.ListContainers(false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not list containers: %w", err)
+	}
+
+	runningNames := map[string]bool{}
+	for _, container := range containers {
+		runningNames[container.Name] = true
+	}
+
+	entries := []psEntry{}
+	for _, container := range containers {
+		if strings.HasSuffix(container.Name, "_DEBUG") {
+			continue
+		}
+
+		info, err := runtime.InspectContainer(container.ID)
+		if err != nil {
+			return nil, fmt.Errorf("could not inspect container %s: %w", container.Name, err)
+		}
+
+		entry := psEntry{
+			Name:           info.Name,
+			ID:             info.ID,
+			Image:          info.Image,
+			ComposeProject: info.Labels["com.docker.compose.project"],
+			ComposeService: info.Labels["com.docker.compose.service"],
+			Pid:            info.Pid,
+			DebugSidecar:   runningNames[info.Name+"_DEBUG"],
+			XdebugRelay:    runningNames[info.Name+xdebugSidecarSuffix],
+			PhpTools:       []string{},
+		}
+
+		journalEntries, err := util.ReadJournal(runtime, info.ID)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the journal of container %s: %w", info.Name, err)
+		}
+		for _, tool := range phpToolIniFiles {
+			for _, iniPath := range phpToolIniPaths(info.Env, journalEntries, tool.IniFile) {
+				exists, err := runtime.PathExists(info.ID, iniPath)
+				if err != nil {
+					return nil, fmt.Errorf("could not check %s in container %s: %w", iniPath, info.Name, err)
+				}
+				if exists {
+					entry.PhpTools = append(entry.PhpTools, tool.Tool)
+					break
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// xdebugSidecarSuffix is appended to the target container name for the sidecar in the network namespace of the
+// target, which hosts the Xdebug relay and IDE probe. It ends with _DEBUG, so that it is treated like the other debug
+// sidecars (e.g. hidden in the container picker). It is still named after the relay, which it hosted first, so that
+// ps, cleanup and scripts keep finding it.
+const xdebugSidecarSuffix = "_RELAY_DEBUG"
+
+// relaySlots is the number of connections which can be accepted concurrently (e.g. parallel debugged requests).
+const relaySlots = 4
+
+// containerPortRelay listens on 127.0.0.1:ContainerPort in the network namespace of the target container, and
+// forwards every connection to LocalAddress on this machine - through the container runtime (docker exec), so it
+// works without any network route from the container to us (Linux without host.docker.internal, remote hosts).
+//
+// The sidecar shares the network namespace of the target; in there, each slot is a "socat TCP-LISTEN ... STDIO"
+// which handles exactly one connection over the stdin/stdout of docker exec. All slots listen with SO_REUSEPORT, and
+// socat closes its listening socket once a connection is accepted, so new connections go to the waiting slots.
+type containerPortRelay struct {
+	ContainerPort int
+	LocalAddress  string
+	// OnConnection is called for each relayed connection, with the error if the local address was not reachable.
+	OnConnection func(err error)
+
+	sidecar *networkSidecar
+
+	mutex    sync.Mutex
+	stopped  bool
+	commands map[*exec.Cmd]bool
+}
+
+// networkSidecar is a (sleeping) container in the network namespace of the target; commands run in it via exec see
+// the network of the target, e.g. 127.0.0.1 is the target's loopback interface.
+type networkSidecar struct {
+	Name       string
+	executable string
+}
+
+// startNetworkSidecar starts a sidecar with the given name in the network namespace of the target.
+func startNetworkSidecar(target *util.Target, debugImage string, name string) (*networkSidecar, error) {
+	runtime := runtimeOrExit()
+	sidecar := &networkSidecar{Name: name, executable: runtimeExecutableOrExit()}
+
+	// a leftover sidecar of an aborted session would block the name.
+	runtime.RemoveContainer(name, true)
+
+	output, err := exec.Command(sidecar.executable, "run", "--rm", "-d",
+		"--name", name,
+		"--network", "container:"+target.ID,
+		runtime.HelperImage(debugImage),
+		"sleep", "infinity",
+	).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("could not start sidecar %s: %w - %s", name, err, output)
+	}
+	return sidecar, nil
+}
+
+// Command returns an exec command for the given arguments in the sidecar.
+func (s *networkSidecar) Command(interactive bool, args ...string) *exec.Cmd {
+	execArgs := []string{"exec"}
+	if interactive {
+		execArgs = append(execArgs, "-i")
+	}
+	execArgs = append(execArgs, s.Name)
+	return exec.Command(s.executable, append(execArgs, args...)...)
+}
+
+// Stop removes the sidecar; which also terminates all commands running in it.
+func (s *networkSidecar) Stop() {
+	if s == nil {
+		return
+	}
+	if err := runtimeOrExit().RemoveContainer(s.Name, true); err != nil {
+		color.Printf("<red>ERROR: Could not remove sidecar %s: %s</>\n", s.Name, err)
+	}
+}
+
+// startContainerPortRelay starts the relay slots in the given sidecar; onConnection may be nil.
+func startContainerPortRelay(sidecar *networkSidecar, containerPort int, localAddress string, onConnection func(err error)) *containerPortRelay {
+	relay := &containerPortRelay{
+		ContainerPort: containerPort,
+		LocalAddress:  localAddress,
+		OnConnection:  onConnection,
+		sidecar:       sidecar,
+		commands:      map[*exec.Cmd]bool{},
+	}
+	for i := 0; i < relaySlots; i++ {
+		go relay.runSlot()
+	}
+	return relay
+}
+
+// Stop terminates all slots; the sidecar is kept.
+func (r *containerPortRelay) Stop() {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.stopped = true
+	for c := range r.commands {
+		c.Process.Kill()
+	}
+	r.mutex.Unlock()
+}
+
+func (r *containerPortRelay) isStopped() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.stopped
+}
+
+// runSlot relays one connection after the other, until the relay is stopped.
+func (r *containerPortRelay) runSlot() {
+	for !r.isStopped() {
+		if err := r.relayOneConnection(); err != nil && !r.isStopped() {
+			// e.g. the sidecar is not up yet; do not spin.
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (r *containerPortRelay) relayOneConnection() error {
+	c := r.sidecar.Command(true,
+		"socat", "TCP-LISTEN:"+strconv.Itoa(r.ContainerPort)+",bind=127.0.0.1,reuseaddr,reuseport", "STDIO",
+	)
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	if r.stopped {
+		r.mutex.Unlock()
+		return nil
+	}
+	if err := c.Start(); err != nil {
+		r.mutex.Unlock()
+		return err
+	}
+	r.commands[c] = true
+	r.mutex.Unlock()
+
+	defer func() {
+		r.mutex.Lock()
+		delete(r.commands, c)
+		r.mutex.Unlock()
+	}()
+
+	// the connecting side speaks first (Xdebug sends its init packet); so we only connect to the local address
+	// once a connection was accepted in the container.
+	buffer := make([]byte, 32*1024)
+	n, readErr := stdout.Read(buffer)
+	if n == 0 {
+		stdin.Close()
+		c.Wait()
+		return readErr
+	}
+
+	local, err := net.Dial("tcp", r.LocalAddress)
+	if r.OnConnection != nil {
+		r.OnConnection(err)
+	}
+	if err != nil {
+		// closing stdin ends socat, which closes the connection in the container.
+		stdin.Close()
+		c.Wait()
+		return nil
+	}
+	defer local.Close()
+
+	local.Write(buffer[:n])
+	done := make(chan struct{})
+	go func() {
+		io.Copy(local, stdout)
+		if tcpConn, ok := local.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(stdin, local)
+	stdin.Close()
+	<-done
+	c.Wait()
+	return nil
+}
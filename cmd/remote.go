@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sshPortForward is a running "ssh -N" process, which keeps port forwards to the remote docker host open.
+type sshPortForward struct {
+	cmd *exec.Cmd
+}
+
+// startSshPortForward starts ssh with the given -L / -R arguments; it fails if the forwards cannot be established.
+func startSshPortForward(remote *util.RemoteDockerHost, forwardArgs ...string) (*sshPortForward, error) {
+	args := remote.SshArgs(append([]string{"-N", "-o", "ExitOnForwardFailure=yes"}, forwardArgs...)...)
+	c := exec.Command("ssh", args...)
+	c.Stderr = os.Stderr
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("could not start ssh to %s: %w", remote.SshDestination(), err)
+	}
+
+	// ssh does not tell us when the forwards are established; but with ExitOnForwardFailure, it exits quickly if
+	// they are not.
+	exited := make(chan error, 1)
+	go func() {
+		exited <- c.Wait()
+	}()
+	select {
+	case err := <-exited:
+		return nil, fmt.Errorf("ssh port forward to %s failed: %v", remote.SshDestination(), err)
+	case <-time.After(2 * time.Second):
+		return &sshPortForward{cmd: c}, nil
+	}
+}
+
+func (f *sshPortForward) Stop() {
+	if f == nil {
+		return
+	}
+	f.cmd.Process.Kill()
+}
+
+// confirm asks a yes/no question on the terminal; without terminal, the answer is no.
+func confirm(question string) bool {
+	if !stdinIsTerminal() {
+		return false
+	}
+	color.Printf("%s <op=bold;>[y/N]</> ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// freeLocalPort returns port if it is free on this machine, and a random free port otherwise.
+func freeLocalPort(port int) int {
+	for _, candidate := range []int{port, 0} {
+		listener, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(candidate))
+		if err != nil {
+			continue
+		}
+		freePort := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+		return freePort
+	}
+	return port
+}
+
+// publishedPortForwardTarget returns the address on the remote host at which the published port is listening.
+func publishedPortForwardTarget(binding util.PortBinding) string {
+	host := binding.HostIp
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(binding.HostPort))
+}
+
+// publishedPortUrls returns a base URL (scheme and host) for each published port of the target, as reachable from
+// this machine. For remote docker hosts with forward set, the ports are forwarded to localhost via SSH.
+func publishedPortUrls(target *util.Target, remote *util.RemoteDockerHost, forward *sshPortForwardedPorts) []string {
+	var urls []string
+	for _, binding := range target.Ports {
+		switch {
+		case remote == nil:
+			urls = append(urls, fmt.Sprintf("http://127.0.0.1:%d", binding.HostPort))
+		case forward != nil:
+			urls = append(urls, fmt.Sprintf("http://127.0.0.1:%d", forward.localPorts[binding.HostPort]))
+		default:
+			if host, ok := remote.PublishedHost(binding.HostIp); ok {
+				urls = append(urls, fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(binding.HostPort))))
+			}
+		}
+	}
+	return urls
+}
+
+// sshPortForwardedPorts are the published ports of a target, forwarded from localhost to the remote docker host.
+type sshPortForwardedPorts struct {
+	*sshPortForward
+	// localPorts maps the published port on the remote host to the port on this machine
+	localPorts map[int]int
+}
+
+// forwardPublishedPorts forwards all published ports of the target to localhost (keeping the port numbers if they
+// are free).
+func forwardPublishedPorts(target *util.Target, remote *util.RemoteDockerHost) (*sshPortForwardedPorts, error) {
+	localPorts := map[int]int{}
+	var args []string
+	for _, binding := range target.Ports {
+		localPort := freeLocalPort(binding.HostPort)
+		localPorts[binding.HostPort] = localPort
+		args = append(args, "-L", fmt.Sprintf("127.0.0.1:%d:%s", localPort, publishedPortForwardTarget(binding)))
+	}
+	forward, err := startSshPortForward(remote, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &sshPortForwardedPorts{sshPortForward: forward, localPorts: localPorts}, nil
+}
+
+// wantsSshForward decides whether port forwards should be set up for a remote docker host: always with
+// --ssh-forward, otherwise the user is asked.
+func wantsSshForward(remote *util.RemoteDockerHost, flag bool, question string) bool {
+	if remote == nil || !remote.Ssh {
+		return false
+	}
+	return flag || confirm(question)
+}
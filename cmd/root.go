@@ -24,6 +24,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/sandstorm/drydock/util"
 	"github.com/spf13/cobra"
 	"log"
 	"os"
@@ -32,12 +33,34 @@ import (
 
 var cfgFile string
 
+// composeOptions are the global docker compose flags, used to resolve SERVICE-or-CONTAINER arguments.
+var composeOptions util.ComposeOptions
+
+// drydockVersion is the version of this binary, e.g. recorded in the journal of modified containers
+var drydockVersion = "dev"
+
+// kubernetesOptions select the cluster and namespace for pod/NAME targets
+var kubernetesOptions util.KubernetesOptions
+
+// runtimeName is the container runtime to use (auto, docker, podman)
+var runtimeName string
+
+// composeIndex selects the replica of a scaled docker compose service
+var composeIndex int
+
 var rootCmd = &cobra.Command{
 	Use: "drydock",
 }
 
 type VSCodeAttachedContainerT struct {
 	ContainerName string `json:"containerName"`
+	// Settings are only needed if the container does not run on the local docker daemon.
+	Settings *VSCodeAttachedContainerSettingsT `json:"settings,omitempty"`
+}
+
+type VSCodeAttachedContainerSettingsT struct {
+	// Host is the docker host in DOCKER_HOST notation (e.g. ssh://user@host); VS Code then connects via SSH.
+	Host string `json:"host,omitempty"`
 }
 
 // see https://pkg.go.dev/github.com/docker/cli/cli-plugins/manager#Metadata
@@ -84,12 +107,19 @@ func buildDockerCliPluginMetadata(version, commit string) *cobra.Command {
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(version, commit string) {
+	drydockVersion = version
 	rootCmd.AddCommand(buildDockerCliPluginMetadata(version, commit))
 	rootCmd.AddCommand(buildExecRootCmd())
 	rootCmd.AddCommand(buildVsCodeCommand())
 	rootCmd.AddCommand(buildSpxCommand())
 	rootCmd.AddCommand(buildXdebugCommand())
 	rootCmd.AddCommand(buildExcimerCommand())
+	rootCmd.AddCommand(buildPhpInfoCommand())
+	rootCmd.AddCommand(buildPsCommand())
+	rootCmd.AddCommand(buildCleanupCommand())
+	rootCmd.AddCommand(buildStatusCommand())
+	rootCmd.AddCommand(buildConfigCommand())
+	rootCmd.AddCommand(buildCacheCommand())
 	rootCmd.AddCommand(buildTemplateProjectCommand())
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -99,4 +129,12 @@ func Execute(version, commit string) {
 
 func init() {
 	cobra.OnInitialize()
+
+	rootCmd.PersistentFlags().StringVarP(&composeOptions.ProjectName, "project-name", "p", "", "docker compose project name, used to look up SERVICE arguments")
+	rootCmd.PersistentFlags().StringArrayVarP(&composeOptions.Files, "file", "f", nil, "docker compose file(s), used to look up SERVICE arguments")
+	rootCmd.PersistentFlags().StringVar(&composeOptions.ProjectDirectory, "project-directory", "", "docker compose project directory, used to look up SERVICE arguments")
+	rootCmd.PersistentFlags().StringVar(&runtimeName, "runtime", util.RuntimeAuto, "container runtime: auto, docker or podman")
+	rootCmd.PersistentFlags().StringVarP(&kubernetesOptions.Namespace, "namespace", "n", "", "kubernetes namespace, used to look up pod/NAME arguments")
+	rootCmd.PersistentFlags().StringVar(&kubernetesOptions.Context, "context", "", "kube context, used to look up pod/NAME arguments")
+	rootCmd.PersistentFlags().IntVar(&composeIndex, "index", 0, "index of the container if the docker compose service has multiple replicas")
 }
@@ -2,24 +2,32 @@ package cmd
 
 import (
 	"github.com/gookit/color"
-	"github.com/jonhadfield/findexec"
 	"github.com/sandstorm/drydock/util"
 	"github.com/spf13/cobra"
-	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 )
 
-// phpSpxInstallScript is running in the debugImage (by default nicolaka/netshoot).
+// phpSpxBuild is running in the debugImage (by default nicolaka/netshoot), if the extension cache has no spx.so for
+// the PHP build of the container yet.
 //   - we mount the inner container to /container (should be based on some base "official" Docker PHP image)
-//   - we php-spx via Git inside nicolaka/netshoot (because we cannot know if git is installed inside the container)
+//   - we clone the given php-spx version (a git tag, or release/latest) via Git inside nicolaka/netshoot (because we
+//     cannot know if git is installed inside the container)
 //   - then, we compile and install php-spx inside the container. This runs as root, because we use the "execroot" mechanics
 //     (important for the `make install` step).
-//   - reload the config
-const phpSpxInstallScript = mountSlashContainer + `
+func phpSpxBuild(version string) phpExtensionBuild {
+	branch := version
+	if version == util.PhpExtensionVersionLatest {
+		branch = "release/latest"
+	}
+	return phpExtensionBuild{
+		Name:    "spx",
+		Version: version,
+		Script: mountSlashContainer + `
 
 rm -Rf /container/php-spx /php-spx
-HTTP_PROXY="" HTTPS_PROXY="" git clone --branch release/latest https://github.com/NoiseByNorthwest/php-spx.git /php-spx
+HTTP_PROXY="" HTTPS_PROXY="" git clone --depth 1 --branch ` + shellQuote(branch) + ` https://github.com/NoiseByNorthwest/php-spx.git /php-spx
 mv /php-spx /container
 
 
@@ -31,25 +39,34 @@ cat << EOF | chroot /container
 	make
 	make install
 EOF
+`,
+	}
+}
 
-cat << EOF > /container$PHP_INI_DIR/conf.d/spx.ini
-extension=spx.so
+// phpSpxInstallScript is running in the debugImage, after spx.so was installed via phpSpxBuild
+//   - write spx.ini into the ini scan dirs found by the PHP probe
+//
+// PHP is reloaded afterwards via reloadPhp.
+func phpSpxInstallScript(config util.Config, php *util.PhpRuntime) string {
+	return mountSlashContainer + phpIniWriteScript(php.IniFiles("spx.ini"), `extension=spx.so
 
 spx.http_enabled=1
-spx.http_key="dev"
+spx.http_key="`+config.Spx.Key+`"
 spx.http_ip_whitelist="*"
-EOF
-
-pkill -USR2 php-fpm
-`
+`)
+}
 
 func buildSpxCommand() *cobra.Command {
 	var debugImage string = "nicolaka/netshoot"
+	var reload phpReloadOptions
+	var extensionVersion string
+	var source string
+	var sshForward bool
 
 	var phpProfilerCommand = &cobra.Command{
-		Use:   "spx [flags] SERVICE-or-CONTAINER",
+		Use:   "spx [flags] [SERVICE-or-CONTAINER]",
 		Short: "Install SPX PHP-Profiler in the given container",
-		Long: color.Sprintf(`Usage:	drydock spx [flags] SERVICE-OR-CONTAINER
+		Long: color.Sprintf(`Usage:	drydock spx [flags] [SERVICE-OR-CONTAINER]
 
 Install the SPX PHP-Profiler https://github.com/NoiseByNorthwest/php-spx into the given PHP Container, and reloads
 the PHP Process such that the profiler is enabled.
@@ -57,6 +74,13 @@ the PHP Process such that the profiler is enabled.
 <op=underscore;>Options:</>
       --debug-image          What debugger docker image to use for executing nsenter and git.
                              By default, nicolaka/netshoot is used 
+      --ssh-forward          If the docker host is remote (ssh://), forward the published ports of the container
+                             to this machine without asking.
+      --version              Version to install, e.g. v0.4.15 or latest. By default, the known-good version for the
+                             PHP version of the container is used (shown by drydock php-info)
+      --source               Build from local sources instead of downloading them, e.g. ./php-spx-0.4.15.tar.gz: a tarball,
+                             a directory with the extracted sources, or a directory with pre-fetched tarballs
+` + phpReloadOptionsHelp + `
 
 <op=underscore;>Examples</>
 
@@ -69,39 +93,27 @@ the PHP Process such that the profiler is enabled.
 <op=underscore;>Background:</>
 
     This command installs the php-spx PHP extension into an existing Docker container, even if the container is locked
-    down to a non-root user. Additionally, we reload the PHP process by using kill -USR2.
+    down to a non-root user. Additionally, we reload PHP depending on the detected SAPI (see --reload), and check that
+    the extension is active (the .so exists, php -m lists it, and the php-fpm workers were restarted). If not, it is
+    removed again, and drydock exits with a non-zero exit code.
 
     This command is using <op=italic;>nsenter</> wrapped in a privileged docker container to install the PHP extension
     inside a running container as root.
 
 `),
-		Args: cobra.ExactArgs(1),
+		Args: cobra.MaximumNArgs(1),
 
 		Run: func(cmd *cobra.Command, args []string) {
-			dockerContainerIdentifier, err := util.TryGetDockerContainerNameFromDockerCompose(args[0])
-
-			if err != nil {
-				// could not identify the docker container identifier; e.g. no docker-compose used.
-				dockerContainerIdentifier = args[0]
-			} else {
-				log.Printf("docker compose service '%s' found, entering it.\n", args[0])
-			}
-
-			pid, err := util.GetRootPidForDockerContainer(dockerContainerIdentifier)
-
-			if err != nil {
-				// container not running
-				log.Printf("FATAL: Container '%s' not running\n", dockerContainerIdentifier)
+			target := resolveTargetOrExit(targetIdentifierFromArgsOrPick(args))
+			config := loadConfigOrExit(target)
+			debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
+			reload = phpReloadOptionsFromFlagsOrConfig(cmd, reload, config)
+			if err := reload.validate(); err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
 				os.Exit(1)
 			}
 
-			fullContainerName, err := util.GetFullContainerName(dockerContainerIdentifier)
-			if err != nil {
-				log.Printf("FATAL: Could not extract container name for container '%s' - THIS SHOULD NOT HAPPEN. Please file a bug report.\n", dockerContainerIdentifier)
-				os.Exit(1)
-			}
-
-			dockerExecutablePathAndFilename := findexec.Find("docker", "")
+			runtimeExecutable := runtimeExecutableOrExit()
 
 			color.Println("")
 			color.Println("")
@@ -111,35 +123,63 @@ the PHP Process such that the profiler is enabled.
 			color.Println("<green>=====================================</>")
 			color.Println("")
 			color.Println("")
-			// we need to get the ENV of the original container to find the PHP_INI_DIR (needed such that "docker-php-ext-enable" will work: https://github.com/docker-library/php/blob/67c242cb1529c70a3969a373ab333c53001c95b8/8.2-rc/bullseye/cli/docker-php-ext-enable)
-			envVars, err := util.GetEnvCliCallsForDockerRunFromContainerMetadata(fullContainerName)
+			// we need to get the ENV of the original container (e.g. PATH and PHP_INI_DIR) for the scripts.
+			envVars := util.EnvCliCallsForDockerRun(target.Env)
+			php := probePhpRuntimeOrExit(target, debugImage, config)
+
+			// Install PHP-SPX (from the extension cache, or built once)
+			build, err := phpExtensionBuildFor(cmd, "spx", extensionVersion, source, php, phpSpxBuild)
 			if err != nil {
-				log.Printf("FATAL: Could not extract env variables for container '%s': %s - THIS SHOULD NOT HAPPEN. Please file a bug report.\n", dockerContainerIdentifier, err)
+				color.Printf("<red>FATAL: %s</>\n", err)
 				os.Exit(1)
 			}
-
-			// Install PHP-SPX
-			dockerRunCommand := dockerRunNsenterCommand(fullContainerName, debugImage, pid, envVars)
+			if err := installPhpExtension(target, debugImage, php, build); err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
+				os.Exit(1)
+			}
+			dockerRunCommand := dockerRunNsenterCommand(target, debugImage, envVars)
 			dockerRunCommand = append(dockerRunCommand, "/bin/bash")
 			dockerRunCommand = append(dockerRunCommand, "-c")
-			dockerRunCommand = append(dockerRunCommand, phpSpxInstallScript)
+			dockerRunCommand = append(dockerRunCommand, journaledScript(phpSpxInstallScript(config, php), newJournalEntry("spx", util.JournalActionInstall, build.Version, append(php.IniFiles("spx.ini"), "/php-spx")...)))
 
-			c := exec.Command(dockerExecutablePathAndFilename, dockerRunCommand[1:]...)
+			c := exec.Command(runtimeExecutable, dockerRunCommand[1:]...)
 			c.Env = os.Environ()
 			c.Stdout = os.Stdout
 			c.Stderr = os.Stderr
 			c.Stdin = os.Stdin
-			c.Run()
+			deactivateScript := journaledScript(mountSlashContainer+phpIniRemoveScript(php.IniFiles("spx.ini")), newJournalEntry("spx", util.JournalActionRemove, build.Version, php.IniFiles("spx.ini")...))
+			if err := c.Run(); err != nil {
+				color.Printf("<red>ERROR: writing spx.ini failed: %s</>\n", err)
+				revertPhpExtensionAndExit(target, debugImage, php, reload, "spx", deactivateScript)
+			}
+			if !activatePhpExtension(target, debugImage, php, reload, "spx") {
+				revertPhpExtensionAndExit(target, debugImage, php, reload, "spx", deactivateScript)
+			}
+
+			remote := runtimeOrExit().Remote()
+			var forward *sshPortForwardedPorts
+			if len(target.Ports) > 0 && wantsSshForward(remote, sshForward, "The docker host is remote. Forward the published ports to this machine via SSH?") {
+				var err error
+				forward, err = forwardPublishedPorts(target, remote)
+				if err != nil {
+					color.Printf("<red>ERROR: %s</>\n", err)
+				}
+			}
 
 			color.Println("")
 			color.Println("")
 			color.Println("<fg=green>=====================================</>")
-			color.Printf("<fg=green;op=bold>Finished installing PHP-SPX into %s</>\n", fullContainerName)
+			color.Printf("<fg=green;op=bold>Finished installing PHP-SPX into %s</>\n", target.Name)
 			color.Println("")
 			color.Println("<fg=green>SPX Profiler URL:</>")
-			hostPorts, _ := util.GetHostPorts(fullContainerName)
-			for _, hostPort := range hostPorts {
-				color.Printf("  - <fg=green;op=bold;>http://127.0.0.1:%d/?SPX_UI_URI=/&SPX_KEY=dev</>\n", hostPort)
+			for _, baseUrl := range publishedPortUrls(target, remote, forward) {
+				color.Printf("  - <fg=green;op=bold;>%s/?SPX_UI_URI=/&SPX_KEY=%s</>\n", baseUrl, config.Spx.Key)
+			}
+			if remote != nil && forward == nil {
+				color.Printf("<fg=yellow>  The docker host %s is remote; ports only published on its loopback interface are not listed.</>\n", remote.Hostname)
+				if remote.Ssh {
+					color.Println("<fg=yellow>  Use --ssh-forward to forward them to this machine.</>")
+				}
 			}
 			color.Println("")
 			color.Println("<fg=green>Profiling CLI requests:</>")
@@ -150,9 +190,22 @@ the PHP Process such that the profiler is enabled.
 			color.Println("<fg=green>- </><fg=green;op=bold;>SPX_ENABLED=1 SPX_REPORT=full</><fg=green> php ...</>")
 			color.Println("<fg=green>    for CLI profiling which can be analyzed in the web UI</>")
 			color.Println("<fg=green>=====================================</>")
+
+			if forward != nil {
+				color.Println("")
+				color.Println("<fg=yellow>To stop the SSH port forward, </><fg=yellow;op=bold>press Ctrl-C</>")
+				signals := make(chan os.Signal, 1)
+				signal.Notify(signals, os.Interrupt)
+				<-signals
+				forward.Stop()
+			}
 		},
 	}
 
+	phpProfilerCommand.Flags().BoolVar(&sshForward, "ssh-forward", false, "If the docker host is remote (ssh://), forward the published ports to this machine without asking")
+	phpProfilerCommand.Flags().StringVar(&extensionVersion, "version", "", "SPX version to install, e.g. v0.4.15 or latest (default: the known-good version for the PHP version)")
+	phpProfilerCommand.Flags().StringVar(&source, "source", "", "Build from local sources (a tarball like php-spx-0.4.15.tar.gz, or a directory) without network access")
+	addPhpReloadFlags(phpProfilerCommand, &reload)
 	phpProfilerCommand.Flags().StringVarP(&debugImage, "debug-image", "", "nicolaka/netshoot", "What debugger docker image to use for executing nsenter. By default, nicolaka/netshoot is used")
 
 	return phpProfilerCommand
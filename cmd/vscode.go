@@ -5,10 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gookit/color"
-	"github.com/jonhadfield/findexec"
 	"github.com/sandstorm/drydock/util"
 	"github.com/spf13/cobra"
-	"log"
 	"os"
 	"os/exec"
 	"syscall"
@@ -18,9 +16,9 @@ func buildVsCodeCommand() *cobra.Command {
 	var debugImage string = "nicolaka/netshoot"
 
 	var execRootCmd = &cobra.Command{
-		Use:   "vscode SERVICE-or-CONTAINER [PATH]",
+		Use:   "vscode [SERVICE-or-CONTAINER-or-pod/NAME [PATH]]",
 		Short: "Opens VScode to a container, where you can edit all files (because using root)",
-		Long: color.Sprintf(`Usage:	drydock vscode SERVICE-OR-CONTAINER [PATH]
+		Long: color.Sprintf(`Usage:	drydock vscode [SERVICE-OR-CONTAINER-OR-pod/NAME[:container] [PATH]]
 
 Open VSCode Remote Containers as root; at path [PATH].
 
@@ -31,52 +29,51 @@ Open VSCode Remote Containers as root; at path [PATH].
 
 <op=bold;>Open a specific folder in VSCode as root user</>
 	drydock vscode <op=italic;>myContainer</> /app
+
+<op=bold;>Choose the container interactively from a list of running containers</>
+	drydock vscode
+
+<op=bold;>Open VSCode in a Kubernetes pod (needs the VSCode Kubernetes and Dev Containers extensions)</>
+	drydock vscode --namespace shop <op=italic;>pod/my-app-1234:php</> /app
 `),
-		Args: cobra.RangeArgs(1, 2),
+		Args: cobra.RangeArgs(0, 2),
 
 		Run: func(cmd *cobra.Command, args []string) {
 			containerPath := "/"
 			if len(args) == 2 {
 				containerPath = args[1]
 			}
-			dockerContainerIdentifier, err := util.TryGetDockerContainerNameFromDockerCompose(args[0])
-
-			if err != nil {
-				// could not identify the docker container identifier; e.g. no docker-compose used.
-				dockerContainerIdentifier = args[0]
-			} else {
-				log.Printf("docker compose service '%s' found, entering it.\n", args[0])
-			}
-
-			pid, err := util.GetRootPidForDockerContainer(dockerContainerIdentifier)
-
-			if err != nil {
-				// container not running
-				log.Printf("FATAL: Container '%s' not running\n", dockerContainerIdentifier)
-				os.Exit(1)
+			identifier := targetIdentifierFromArgsOrPick(args)
+			if util.IsKubernetesTarget(identifier) {
+				config := loadConfigOrExit(nil)
+				debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
+				kubernetesVsCode(identifier, debugImage, containerPath)
+				return
 			}
 
-			fullContainerName, err := util.GetFullContainerName(dockerContainerIdentifier)
-			if err != nil {
-				log.Printf("FATAL: Could not extract container name for container '%s' - THIS SHOULD NOT HAPPEN. Please file a bug report.\n", dockerContainerIdentifier)
-				os.Exit(1)
-			}
+			target := resolveTargetOrExit(identifier)
+			config := loadConfigOrExit(target)
+			debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
 
-			dockerExecutablePathAndFilename := findexec.Find("docker", "")
+			runtimeExecutable := runtimeExecutableOrExit()
 
-			dockerRunCommand := dockerRunNsenterCommand(fullContainerName, debugImage, pid, []string{
+			dockerRunCommand := dockerRunNsenterCommand(target, debugImage, []string{
 				"-it", // interactive, with TTY
 			})
 			// we want to share the network namespace. This means you can e.g. use `curl` like in the debugged application,
 			// using "127.0.0.1:[yourport]" as usual.
 			dockerRunCommand = append(dockerRunCommand, "--net")
 
-			dockerRunCommand = append(dockerRunCommand, "/bin/bash", "-c", "mkdir /procContainer; mount -t proc proc /procContainer; ln -s /procContainer/1/root /container; chroot /container")
+			dockerRunCommand = append(dockerRunCommand, "/bin/bash", "-c", vscodeMountContainerScript)
 
 			obj := &VSCodeAttachedContainerT{
-				ContainerName: "/" + fullContainerName + "_DEBUG",
+				ContainerName: "/" + target.Name + "_DEBUG",
+			}
+			if remote := runtimeOrExit().Remote(); remote != nil {
+				// the local "code" can only attach to the debug container through the remote docker host.
+				obj.Settings = &VSCodeAttachedContainerSettingsT{Host: remote.DockerHost}
 			}
-			bytes, err := json.Marshal(obj)
+			bytes, _ := json.Marshal(obj)
 			encodedStr := hex.EncodeToString(bytes)
 
 			containerToOpen := fmt.Sprintf("attached-container+%s %s", encodedStr, "/container"+containerPath)
@@ -86,26 +83,57 @@ Open VSCode Remote Containers as root; at path [PATH].
 			c := exec.Command("/bin/bash", "-c", "sleep 1; code --remote "+containerToOpen)
 			c.Start()
 
-			color.Printf("<op=bold;>---------------------------------------------------------------------------</>\n")
-			color.Printf("<op=bold;>Do not close this shell</> as long as you want to use VSCode in the container.\n")
-			color.Printf("The connected container file system is mounted in <op=bold;>/container.</>\n")
-			color.Printf("NOTE: the /proc file system of the connected container is mounted to\n")
-			color.Printf("      /procContainer, because otherwise, VS Code does not work.\n")
-			color.Printf("<op=bold;>---------------------------------------------------------------------------</>\n")
-			syscall.Exec(dockerExecutablePathAndFilename, dockerRunCommand, os.Environ())
+			printVsCodeUsage()
+			syscall.Exec(runtimeExecutable, dockerRunCommand, os.Environ())
 		},
 	}
 
+	execRootCmd.Flags().StringVarP(&debugImage, "debug-image", "", "nicolaka/netshoot", "What debugger docker image to use for executing nsenter. By default, nicolaka/netshoot is used")
+
 	return execRootCmd
 }
 
+// vscodeMountContainerScript runs in the debug container: VS Code attaches to the debug container, and finds the
+// target container file system in /container.
+const vscodeMountContainerScript = "mkdir /procContainer; mount -t proc proc /procContainer; ln -s /procContainer/1/root /container; chroot /container"
+
+func printVsCodeUsage() {
+	color.Printf("<op=bold;>---------------------------------------------------------------------------</>\n")
+	color.Printf("<op=bold;>Do not close this shell</> as long as you want to use VSCode in the container.\n")
+	color.Printf("The connected container file system is mounted in <op=bold;>/container.</>\n")
+	color.Printf("NOTE: the /proc file system of the connected container is mounted to\n")
+	color.Printf("      /procContainer, because otherwise, VS Code does not work.\n")
+	color.Printf("<op=bold;>---------------------------------------------------------------------------</>\n")
+}
+
+// kubernetesVsCode is vscode for pod/NAME[:container] targets: VS Code attaches to the debug pod (via the
+// Kubernetes extension), which has the target container file system mounted in /container.
+func kubernetesVsCode(identifier string, debugImage string, containerPath string) {
+	session := startKubernetesDebugSessionOrExit(identifier, debugImage)
+
+	folderUri := fmt.Sprintf("vscode-remote://k8s-container+context=%s+podname=%s+namespace=%s+name=debug%s",
+		session.client.Context, session.debugPod, session.target.Namespace, "/container"+containerPath)
+	c := exec.Command("/bin/bash", "-c", "sleep 1; code --folder-uri "+shellQuote(folderUri))
+	c.Start()
+
+	printVsCodeUsage()
+	exitCode := session.run(kubernetesNsenterCommand("/bin/bash", "-c", vscodeMountContainerScript))
+	session.delete()
+	os.Exit(exitCode)
+}
+
 func ensureImageExistsLocally(debugImage string) {
-	img, err := util.ExecCommand("docker", "image", "ls", debugImage)
-	if err == nil && len(img) > 0 {
+	runtime := runtimeOrExit()
+	image := runtime.HelperImage(debugImage)
+	exists, err := runtime.ImageExists(image)
+	if err == nil && exists {
 		// we found the image locally
 		return
 	}
 
-	pullCmd := exec.Command("docker", "pull", debugImage)
-	pullCmd.Run()
+	color.Printf("Pulling <op=bold;>%s</>...\n", image)
+	if err := runtime.PullImage(image); err != nil {
+		color.Printf("<red>FATAL: %s</>\n", err)
+		os.Exit(1)
+	}
 }
@@ -1,67 +1,115 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/gookit/color"
-	"github.com/jonhadfield/findexec"
 	"github.com/sandstorm/drydock/util"
 	"github.com/spf13/cobra"
-	"log"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// phpXdebugInstallScript is running in the debugImage
-//   - we mount the inner container to /container (should be based on some base "official" Docker PHP image)
-//   - we php-spx via Git inside nicolaka/netshoot (because we cannot know if git is installed inside the container)
-//   - then, we compile and install php-spx inside the container. This runs as root, because we use the "execroot" mechanics
-//     (important for the `make install` step).
-//   - reload the config
-func phpXdebugInstallScript(pid string) string {
-	// fall back to xdebug 3.1.6 for PHP 7.4 if xdebug 3.2 (the newest version) did not work
-	return mountSlashContainer + `
+// phpXdebugBuild compiles the given Xdebug version via pecl inside the container; it is only run if the extension cache
+// has no xdebug.so for the PHP build of the container yet.
+func phpXdebugBuild(version string) phpExtensionBuild {
+	return phpExtensionBuild{
+		Name:    "xdebug",
+		Version: version,
+		Script: mountSlashContainer + `
 cat << EOF | chroot /container
 	export HTTP_PROXY=""
 	export HTTPS_PROXY=""
-	pecl install xdebug || pecl install xdebug-3.1.6
+	pecl install -f ` + peclPackage("xdebug", version) + `
 EOF
+`,
+		// pecl downloads the sources
+		Net: true,
+	}
+}
 
-if [ ! -d /container$PHP_INI_DIR ]; then
-    echo "!!!! PHP_INI_DIR not set."
-    echo "!!!! please set it as env in docker compose."
-    exit 1
-fi;
+// phpXdebugInstallScript is running in the debugImage, after xdebug.so was installed via phpXdebugBuild
+//   - we mount the inner container to /container
+//   - write xdebug.ini into the ini scan dirs found by the PHP probe
+//
+// PHP is reloaded afterwards via reloadPhp.
+func phpXdebugInstallScript(config util.Config, php *util.PhpRuntime, discoverClientHost bool, collectCoverage bool) string {
+	prependFile := ""
+	coverageScript := ""
+	if collectCoverage {
+		prependFile = xdebugCoveragePrependFile
+		// must run before xdebug.ini is written, as it reads the previously configured auto_prepend_file
+		coverageScript = xdebugCoveragePrependScript(php.Binary)
+	}
 
-cat << EOF > /container$PHP_INI_DIR/conf.d/xdebug.ini
-zend_extension=xdebug.so
+	return mountSlashContainer + coverageScript +
+		phpIniWriteScript(php.IniFiles("xdebug.ini"), xdebugIni(config.Xdebug, discoverClientHost, prependFile)) +
+		xdebugOutputDirPrepareScript()
+}
 
-xdebug.mode = develop,debug
-xdebug.client_host = host.docker.internal
-xdebug.discover_client_host = true
+// xdebugIni is the content of xdebug.ini for the given settings; prependFile is set as auto_prepend_file if not empty.
+func xdebugIni(xdebug util.XdebugConfig, discoverClientHost bool, prependFile string) string {
+	ini := `zend_extension=xdebug.so
+
+xdebug.mode = ` + xdebug.Mode + `
+xdebug.client_host = ` + xdebug.ClientHost + `
+xdebug.client_port = ` + strconv.Itoa(xdebug.ClientPort) + `
+xdebug.discover_client_host = ` + strconv.FormatBool(discoverClientHost) + `
+xdebug.start_with_request = ` + xdebug.StartWithRequest + `
+xdebug.output_dir = ` + xdebugOutputDir + `
+xdebug.trace_format = 1
+xdebug.trace_output_name = trace.%t.%p.%r
 xdebug.max_nesting_level = 2048
-EOF
-
-echo "restarting php-fpm"
-pkill -USR2 php-fpm
 `
+	if xdebug.IdeKey != "" {
+		ini += "xdebug.idekey = " + xdebug.IdeKey + "\n"
+	}
+	if xdebug.LogEnabled() {
+		ini += "xdebug.log = " + xdebugLogFile + "\n"
+	}
+	if prependFile != "" {
+		ini += "auto_prepend_file = " + prependFile + "\n"
+	}
+	return ini
 }
 
-func phpXdebugDeactivateScript() string {
-	return mountSlashContainer + `
-rm /container$PHP_INI_DIR/conf.d/xdebug.ini
-pkill -USR2 php-fpm
-`
+func phpXdebugDeactivateScript(php *util.PhpRuntime) string {
+	return mountSlashContainer + phpIniRemoveScript(append(php.IniFiles("xdebug.ini"), xdebugCoveragePrependFile))
 }
 
+// xdebugLogFile is xdebug.log inside the container, if enabled via --log.
+const xdebugLogFile = "/tmp/xdebug.log"
+
 func buildXdebugCommand() *cobra.Command {
 	var debugImage string = "nicolaka/netshoot"
+	var reload phpReloadOptions
+	var extensionVersion string
+	var source string
+	var sshForward bool
+	var relay bool
+	defaults := util.DefaultConfig().Xdebug
+	var mode string
+	var clientHost string
+	var clientPort int
+	var ideKey string
+	var startWithRequest string
+	var log bool
+	var profile bool
+	var profileTop int
+	var outputDir string
+	var trace bool
+	var traceSummary xdebugTraceSummaryOptions
+	var coverage bool
+	var coverageFormat string
 
 	var command = &cobra.Command{
-		Use:   "xdebug [flags] SERVICE-or-CONTAINER",
+		Use:   "xdebug [flags] [SERVICE-or-CONTAINER]",
 		Short: "Run Xdebug in the given container",
-		Long: color.Sprintf(`Usage:	drydock xdebug [flags] SERVICE-OR-CONTAINER
+		Long: color.Sprintf(`Usage:	drydock xdebug [flags] [SERVICE-OR-CONTAINER]
 
 Run Xdebug https://xdebug.org in the given PHP Container, and reloads
 the PHP Process such that the debugger is enabled.
@@ -69,6 +117,38 @@ the PHP Process such that the debugger is enabled.
 <op=underscore;>Options:</>
       --debug-image          What debugger docker image to use for executing nsenter (and optionally the NFS webdav server).
                              By default, nicolaka/netshoot is used
+      --mode                 xdebug.mode, a comma separated list of develop, debug, profile, trace, coverage, gcstats
+                             and off. By default, develop,debug is used
+      --client-host          xdebug.client_host, the host of the IDE as seen from the container. By default,
+                             host.docker.internal is used (with xdebug.discover_client_host enabled)
+      --client-port          xdebug.client_port, the port the IDE listens on. By default, 9003 is used
+      --idekey               xdebug.idekey, needed e.g. for DBGp proxies. By default, it is not set
+      --start-with-request   xdebug.start_with_request: trigger (only with XDEBUG_SESSION/XDEBUG_TRIGGER), yes
+                             (every request), or default (yes for profile, trigger otherwise)
+      --log                  Write xdebug.log to /tmp/xdebug.log inside the container, to diagnose connection issues
+      --profile              Enable the profiler (xdebug.mode=profile). On Ctrl-C, the cachegrind files are copied to
+                             --output-dir, and the slowest functions of each profile are printed
+      --profile-top          Number of functions to print per profile (by inclusive time); 0 disables the summary.
+                             By default, 10 is used
+      --trace                Enable function traces (xdebug.mode=trace). On Ctrl-C, the trace files are copied to
+                             --output-dir, and a summary of each trace is printed
+      --trace-top            Number of functions to print per trace (by call count); 0 disables the table.
+                             By default, 20 is used
+      --trace-tree-depth     Depth of the printed call tree; 0 disables it. By default, 3 is used
+      --trace-filter         Only show functions starting with this prefix in table and call tree, e.g. 'Neos\'
+      --coverage             Record the code coverage of every request (xdebug.mode=coverage, via auto_prepend_file).
+                             On Ctrl-C, the coverage of all requests is merged into --output-dir/coverage.info
+      --coverage-format      lcov (coverage.info) or clover (coverage.xml). By default, lcov is used
+      --output-dir           Local directory for the files copied from the container. By default, ./drydock-xdebug
+      --ssh-forward          If the docker host is remote (ssh://), forward Xdebug connections from it to this
+                             machine without asking.
+      --relay                Relay Xdebug connections through drydock to the IDE on this machine, instead of
+                             connecting to host.docker.internal (see Background).
+      --version              Version to install, e.g. 3.3.2 or latest. By default, the known-good version for the
+                             PHP version of the container is used (shown by drydock php-info)
+      --source               Build from local sources instead of downloading them, e.g. ./xdebug-3.3.2.tgz: a tarball,
+                             a directory with the extracted sources, or a directory with pre-fetched tarballs
+` + phpReloadOptionsHelp + `
 
 <op=underscore;>Examples</>
 
@@ -78,20 +158,39 @@ the PHP Process such that the debugger is enabled.
 <op=bold;>Run Xdebug in a running docker-compose service</>
 	drydock xdebug <op=italic;>my-docker-compose-service</>
 
+<op=bold;>Run Xdebug on plain Linux docker or a remote docker host (no host.docker.internal)</>
+	drydock xdebug --relay <op=italic;>myContainer</>
+
+<op=bold;>Profile every request, and debug connection problems</>
+	drydock xdebug --profile <op=italic;>myContainer</>
+	drydock xdebug --trace --trace-filter='Neos\' <op=italic;>myContainer</>
+
+<op=bold;>Which code did a manual test session execute?</>
+	drydock xdebug --coverage --coverage-format=clover <op=italic;>myContainer</>
+	drydock xdebug --log <op=italic;>myContainer</>
+
 <op=underscore;>Background:</>
 
     This command installs the Xdebug PHP extension into an existing Docker container, even if the container is locked
-    down to a non-root user. Additionally, we reload the PHP process by using kill -USR2.
+    down to a non-root user. Additionally, we reload PHP depending on the detected SAPI (see --reload), and check that
+    the extension is active (the .so exists, php -m lists it, and the php-fpm workers were restarted). If not, it is
+    removed again, and drydock exits with a non-zero exit code.
 
     This command is using <op=italic;>nsenter</> wrapped in a privileged docker container to install the PHP extension
     inside a running container as root.
 
+    Before Xdebug is enabled, drydock warns if nothing listens on 127.0.0.1:9003 on this machine. While the session
+    is active, a status line shows whether the IDE is listening, whether xdebug.client_host is reachable from the
+    container (probed from a sidecar container in its network namespace), and the Xdebug connections seen.
+
+    With <op=italic;>--relay</>, the sidecar container in the network namespace of the container listens on 127.0.0.1:9003,
+    and every Xdebug connection is forwarded through <op=italic;>docker exec</> and drydock to 127.0.0.1:9003 on this
+    machine. <op=italic;>xdebug.client_host</> is then set to 127.0.0.1.
+
 `),
-		Args: cobra.ExactArgs(1),
+		Args: cobra.MaximumNArgs(1),
 
 		Run: func(cmd *cobra.Command, args []string) {
-			//isOpen := isXdebugPortOpenInIde("127.0.0.1", "9003")
-
 			color.Println("")
 			color.Println("")
 			color.Println("<green>=====================================</>")
@@ -100,61 +199,164 @@ the PHP Process such that the debugger is enabled.
 			color.Println("<green>=====================================</>")
 			color.Println("")
 
-			dockerContainerIdentifier, err := util.TryGetDockerContainerNameFromDockerCompose(args[0])
+			target := resolveTargetOrExit(targetIdentifierFromArgsOrPick(args))
+			config := loadConfigOrExit(target)
+			debugImage = stringFlagOrConfig(cmd, "debug-image", debugImage, config.DebugImage)
+			reload = phpReloadOptionsFromFlagsOrConfig(cmd, reload, config)
+			if err := reload.validate(); err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
+				os.Exit(1)
+			}
+			relay = boolFlagOrConfig(cmd, "relay", relay, config.Xdebug.Relay)
+			config.Xdebug.Mode = stringFlagOrConfig(cmd, "mode", mode, config.Xdebug.Mode)
+			config.Xdebug.ClientHost = stringFlagOrConfig(cmd, "client-host", clientHost, config.Xdebug.ClientHost)
+			config.Xdebug.ClientPort = intFlagOrConfig(cmd, "client-port", clientPort, config.Xdebug.ClientPort)
+			config.Xdebug.IdeKey = stringFlagOrConfig(cmd, "idekey", ideKey, config.Xdebug.IdeKey)
+			config.Xdebug.StartWithRequest = stringFlagOrConfig(cmd, "start-with-request", startWithRequest, config.Xdebug.StartWithRequest)
+			log = boolFlagOrConfig(cmd, "log", log, config.Xdebug.Log)
+			config.Xdebug.Log = &log
+			if profile && !config.Xdebug.HasMode("profile") {
+				config.Xdebug.Mode = addXdebugMode(cmd, config.Xdebug.Mode, "profile")
+			}
+			if trace && !config.Xdebug.HasMode("trace") {
+				config.Xdebug.Mode = addXdebugMode(cmd, config.Xdebug.Mode, "trace")
+			}
+			if coverage && !config.Xdebug.HasMode("coverage") {
+				config.Xdebug.Mode = addXdebugMode(cmd, config.Xdebug.Mode, "coverage")
+			}
+			if coverageFormat != xdebugCoverageFormatLcov && coverageFormat != xdebugCoverageFormatClover {
+				color.Printf("<red>FATAL: unknown coverage format %s - must be %s or %s</>\n", coverageFormat, xdebugCoverageFormatLcov, xdebugCoverageFormatClover)
+				os.Exit(1)
+			}
+			if err := config.Xdebug.Validate(); err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
+				os.Exit(1)
+			}
+			// the IDE (and thus probe, relay and port forwards) is only needed for step debugging.
+			stepDebugging := config.Xdebug.HasMode("debug")
+
+			// if the client host was configured explicitly, Xdebug should not try the IP of the HTTP client first.
+			discoverClientHost := config.Xdebug.ClientHost == defaults.ClientHost
+			if relay {
+				if cmd.Flags().Changed("client-host") {
+					color.Println("<fg=yellow>--client-host is ignored with --relay.</>")
+				}
+				// the relay listens in the network namespace of the container.
+				config.Xdebug.ClientHost = "127.0.0.1"
+				discoverClientHost = false
+			}
+			xdebugPort := config.Xdebug.ClientPort
+
+			runtimeExecutable := runtimeExecutableOrExit()
 
-			if err != nil {
-				// could not identify the docker container identifier; e.g. no docker-compose used.
-				dockerContainerIdentifier = args[0]
-			} else {
-				color.Printf("<green>docker compose service </><fg=green;op=bold;>%s</><fg=green> found, entering it.</>\n", args[0])
-				color.Println("")
+			if stepDebugging {
+				warnIfIdeNotListening(xdebugPort)
 			}
 
-			pid, err := util.GetRootPidForDockerContainer(dockerContainerIdentifier)
+			// we need to get the ENV of the original container (e.g. PATH and PHP_INI_DIR) for the scripts.
+			extraDockerRunArgs := util.EnvCliCallsForDockerRun(target.Env)
+			php := probePhpRuntimeOrExit(target, debugImage, config)
 
-			if err != nil || pid == "0" {
-				// container not running
-				color.Printf("<red>FATAL: Container </><fg=red;op=bold;>%s</><fg=red> not running.</>\n", dockerContainerIdentifier)
-				color.Println("")
+			if !php.VersionAtLeast(7, 2) {
+				color.Printf("<red>FATAL: PHP %s is too old - drydock only supports Xdebug 3, which needs PHP 7.2 or newer.</>\n", php.Version)
 				os.Exit(1)
 			}
 
-			fullContainerName, err := util.GetFullContainerName(dockerContainerIdentifier)
+			// Install XDEBUG (from the extension cache, or built once)
+			build, err := phpExtensionBuildFor(cmd, "xdebug", extensionVersion, source, php, phpXdebugBuild)
+			if err == nil {
+				err = validateXdebug3Version(build.Version)
+			}
 			if err != nil {
-				color.Printf("<red>FATAL: Could not extract container name for container </><fg=red;op=bold;>%s</><fg=red> - THIS SHOULD NOT HAPPEN. Please file a bug report.</>\n", dockerContainerIdentifier)
-				color.Println("")
+				color.Printf("<red>FATAL: %s</>\n", err)
 				os.Exit(1)
 			}
-
-			dockerExecutablePathAndFilename := findexec.Find("docker", "")
-
-			// we need to get the ENV of the original container to find the PHP_INI_DIR (needed such that "docker-php-ext-enable" will work: https://github.com/docker-library/php/blob/67c242cb1529c70a3969a373ab333c53001c95b8/8.2-rc/bullseye/cli/docker-php-ext-enable)
-			extraDockerRunArgs, err := util.GetEnvCliCallsForDockerRunFromContainerMetadata(fullContainerName)
-			if err != nil {
-				log.Printf("FATAL: Could not extract env variables for container '%s': %s - THIS SHOULD NOT HAPPEN. Please file a bug report.\n", dockerContainerIdentifier, err)
+			if err := installPhpExtension(target, debugImage, php, build); err != nil {
+				color.Printf("<red>FATAL: %s</>\n", err)
 				os.Exit(1)
 			}
-
-			// Install XDEBUG
-			dockerRunCommand := dockerRunNsenterCommand(fullContainerName, debugImage, pid, extraDockerRunArgs)
-			dockerRunCommand = append(dockerRunCommand, "--net") // to download files now, we need to mount the network filesystem.
+			dockerRunCommand := dockerRunNsenterCommand(target, debugImage, extraDockerRunArgs)
 			dockerRunCommand = append(dockerRunCommand, "/bin/bash")
 			dockerRunCommand = append(dockerRunCommand, "-c")
-			dockerRunCommand = append(dockerRunCommand, phpXdebugInstallScript(pid))
+			installedFiles := php.IniFiles("xdebug.ini")
+			if coverage {
+				installedFiles = append(installedFiles, xdebugCoveragePrependFile)
+			}
+			// the output dir is removed separately (removeXdebugOutputDir), after its files were fetched.
+			dockerRunCommand = append(dockerRunCommand, journaledScript(phpXdebugInstallScript(config, php, discoverClientHost, coverage), newJournalEntry("xdebug", util.JournalActionInstall, build.Version, append(installedFiles, xdebugOutputDir)...)))
+			deactivateScript := journaledScript(phpXdebugDeactivateScript(php), newJournalEntry("xdebug", util.JournalActionRemove, build.Version, installedFiles...))
 
-			dockerRunC := exec.Command(dockerExecutablePathAndFilename, dockerRunCommand[1:]...)
+			dockerRunC := exec.Command(runtimeExecutable, dockerRunCommand[1:]...)
 			dockerRunC.Env = os.Environ()
 			dockerRunC.Stdout = os.Stdout
 			dockerRunC.Stderr = os.Stderr
-			dockerRunC.Run()
+			if err := dockerRunC.Run(); err != nil {
+				color.Printf("<red>ERROR: writing xdebug.ini failed: %s</>\n", err)
+				revertPhpExtensionAndExit(target, debugImage, php, reload, "xdebug", deactivateScript)
+			}
+			if !activatePhpExtension(target, debugImage, php, reload, "xdebug") {
+				revertPhpExtensionAndExit(target, debugImage, php, reload, "xdebug", deactivateScript)
+			}
+
+			// on a remote docker host, Xdebug connects to the remote host (and not to the IDE on this machine); so we
+			// forward the port from there to us.
+			remote := runtimeOrExit().Remote()
+			var forward *sshPortForward
+			var xdebugRelay *containerPortRelay
+			var sidecar *networkSidecar
+			var probe *ideProbe
+
+			if stepDebugging {
+				// the sidecar in the network namespace of the container probes the IDE from there, and hosts the relay.
+				var err error
+				sidecar, err = startNetworkSidecar(target, debugImage, target.Name+xdebugSidecarSuffix)
+				if err != nil {
+					color.Printf("<red>ERROR: %s</>\n", err)
+					if !relay {
+						color.Println("<fg=yellow>The IDE is only probed from this machine, not from the container.</>")
+					}
+				}
+				// for the relay, client_host is the relay itself; so there is no point in probing it.
+				probedClientHost := config.Xdebug.ClientHost
+				if relay {
+					probedClientHost = ""
+				}
+
+				probe = newIdeProbe(probedClientHost, xdebugPort, sidecar)
+
+				if relay && sidecar != nil {
+					// the relay does not need any port forwards, as it runs through the container runtime.
+					remote = nil
+					xdebugRelay = startContainerPortRelay(sidecar, xdebugPort, net.JoinHostPort("127.0.0.1", strconv.Itoa(xdebugPort)), probe.OnRelayConnection)
+					color.Printf("<green>Relaying Xdebug connections from </><fg=green;op=bold;>127.0.0.1:%d</><green> in the container to </><fg=green;op=bold;>127.0.0.1:%d</><green> on this machine.</>\n", xdebugPort, xdebugPort)
+				}
+				if remote != nil {
+					color.Printf("<fg=yellow>The docker host %s is remote: xdebug.client_host (%s) needs to point to it, as seen from the container.</>\n", remote.Hostname, config.Xdebug.ClientHost)
+				}
+				if wantsSshForward(remote, sshForward, fmt.Sprintf("Forward Xdebug connections (port %d) from the docker host to this machine via SSH?", xdebugPort)) {
+					// binding to all interfaces of the remote host needs "GatewayPorts clientspecified" in its sshd_config;
+					// otherwise the containers cannot reach the forwarded port.
+					forward, err = startSshPortForward(remote, "-R", fmt.Sprintf("0.0.0.0:%d:127.0.0.1:%d", xdebugPort, xdebugPort))
+					if err != nil {
+						color.Printf("<red>ERROR: %s</>\n", err)
+					}
+				}
+			}
 
 			c := make(chan os.Signal, 1)
 			signal.Notify(c, os.Interrupt)
 
-			printXdebugUsage(fullContainerName)
+			printXdebugUsage(target.Name, config.Xdebug, coverage)
+			if probe != nil {
+				probe.Start()
+			}
 			// wait for ctrl-c
 			<-c
+			probe.Stop()
 			color.Println("<fg=yellow>Ctrl-C pressed. Aborting...</>")
+			forward.Stop()
+			xdebugRelay.Stop()
+			sidecar.Stop()
 
 			color.Println("<green>=====================================</>")
 			color.Printf("<green>Disabling Xdebug</>\n")
@@ -162,16 +364,34 @@ the PHP Process such that the debugger is enabled.
 			color.Println("")
 			// Removing XDebug
 			// Install XDEBUG and prepare for NFS Server
-			dockerRunCommand = dockerRunNsenterCommand(fullContainerName, debugImage, pid, extraDockerRunArgs)
+			dockerRunCommand = dockerRunNsenterCommand(target, debugImage, extraDockerRunArgs)
 			dockerRunCommand = append(dockerRunCommand, "/bin/bash")
 			dockerRunCommand = append(dockerRunCommand, "-c")
-			dockerRunCommand = append(dockerRunCommand, phpXdebugDeactivateScript())
+			dockerRunCommand = append(dockerRunCommand, deactivateScript)
 
-			dockerRunC = exec.Command(dockerExecutablePathAndFilename, dockerRunCommand[1:]...)
+			dockerRunC = exec.Command(runtimeExecutable, dockerRunCommand[1:]...)
 			dockerRunC.Env = os.Environ()
 			dockerRunC.Stdout = os.Stdout
 			dockerRunC.Stderr = os.Stderr
-			dockerRunC.Run()
+			if err := dockerRunC.Run(); err != nil {
+				color.Printf("<red>ERROR: disabling Xdebug failed: %s</>\n", err)
+				os.Exit(1)
+			}
+			if err := reloadPhp(target, debugImage, php, reload); err != nil {
+				color.Printf("<red>ERROR: %s</>\n", err)
+			}
+
+			// the files are fetched after Xdebug was disabled and PHP reloaded, so that no new request writes them.
+			if config.Xdebug.HasMode("profile") {
+				fetchXdebugProfiles(target, debugImage, outputDir, profileTop)
+			}
+			if config.Xdebug.HasMode("trace") {
+				fetchXdebugTraces(target, debugImage, outputDir, traceSummary)
+			}
+			if coverage {
+				fetchXdebugCoverage(target, debugImage, config, outputDir, coverageFormat)
+			}
+			removeXdebugOutputDir(target, debugImage, build.Version)
 
 			color.Println("<green>=====================================</>")
 			color.Printf("<green>All done!</>\n")
@@ -181,52 +401,160 @@ the PHP Process such that the debugger is enabled.
 		},
 	}
 
+	command.Flags().StringVar(&mode, "mode", defaults.Mode, "xdebug.mode, comma separated: develop, debug, profile, trace, coverage, gcstats, off")
+	command.Flags().StringVar(&clientHost, "client-host", defaults.ClientHost, "xdebug.client_host, the host of the IDE as seen from the container")
+	command.Flags().IntVar(&clientPort, "client-port", defaults.ClientPort, "xdebug.client_port, the port the IDE listens on")
+	command.Flags().StringVar(&ideKey, "idekey", defaults.IdeKey, "xdebug.idekey (not set by default)")
+	command.Flags().StringVar(&startWithRequest, "start-with-request", defaults.StartWithRequest, "xdebug.start_with_request: trigger, yes or default")
+	command.Flags().BoolVar(&log, "log", false, "Write xdebug.log to "+xdebugLogFile+" inside the container")
+	command.Flags().BoolVar(&profile, "profile", false, "Enable the profiler, and copy the cachegrind files to --output-dir on Ctrl-C")
+	command.Flags().IntVar(&profileTop, "profile-top", 10, "Number of functions to print per profile (0 disables the summary)")
+	command.Flags().BoolVar(&trace, "trace", false, "Enable function traces, and copy the trace files to --output-dir on Ctrl-C")
+	command.Flags().IntVar(&traceSummary.Top, "trace-top", 20, "Number of functions to print per trace, by call count (0 disables the table)")
+	command.Flags().IntVar(&traceSummary.TreeDepth, "trace-tree-depth", 3, "Depth of the printed call tree (0 disables it)")
+	command.Flags().StringVar(&traceSummary.Filter, "trace-filter", "", "Only show functions starting with this prefix, e.g. 'Neos\\'")
+	command.Flags().BoolVar(&coverage, "coverage", false, "Record the code coverage of every request, and merge it into --output-dir on Ctrl-C")
+	command.Flags().StringVar(&coverageFormat, "coverage-format", xdebugCoverageFormatLcov, "Format of the merged coverage: lcov or clover")
+	command.Flags().StringVar(&outputDir, "output-dir", "drydock-xdebug", "Local directory for profiles (and other files) copied from the container")
+	command.Flags().BoolVar(&relay, "relay", false, "Relay Xdebug connections through drydock to the IDE on this machine (client_host is set to 127.0.0.1)")
+	command.Flags().BoolVar(&sshForward, "ssh-forward", false, "If the docker host is remote (ssh://), forward Xdebug connections to this machine without asking")
+	command.Flags().StringVar(&extensionVersion, "version", "", "Xdebug version to install, e.g. 3.3.2 or latest (default: the known-good version for the PHP version)")
+	command.Flags().StringVar(&source, "source", "", "Build from local sources (a tarball like xdebug-3.3.2.tgz, or a directory) without network access")
+	addPhpReloadFlags(command, &reload)
 	command.Flags().StringVarP(&debugImage, "debug-image", "", "nicolaka/netshoot", "What debugger docker image to use for executing nsenter. By default, gists/nfs-server is used")
 
 	return command
 }
 
-func printXdebugUsage(fullContainerName string) {
+// validateXdebug3Version rejects Xdebug 2 (e.g. --version 2.9.8): xdebugIni only contains Xdebug 3 settings, which
+// Xdebug 2 silently ignores.
+func validateXdebug3Version(version string) error {
+	var major int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(version, "v"), "%d", &major); err != nil {
+		// "latest", or local sources without version
+		return nil
+	}
+	if major < 3 {
+		return fmt.Errorf("xdebug %s is not supported - drydock only writes Xdebug 3 settings (xdebug.mode, ...)", version)
+	}
+	return nil
+}
+
+// addXdebugMode adds mode to the configured modes; for a shortcut like --profile, it replaces the default mode
+// (develop,debug), unless --mode was given explicitly.
+func addXdebugMode(cmd *cobra.Command, modes string, mode string) string {
+	if !cmd.Flags().Changed("mode") && modes == util.DefaultConfig().Xdebug.Mode {
+		return mode
+	}
+	return modes + "," + mode
+}
+
+func printXdebugUsage(fullContainerName string, xdebug util.XdebugConfig, collectCoverage bool) {
+	sessionValue := "1"
+	if xdebug.IdeKey != "" {
+		sessionValue = xdebug.IdeKey
+	}
+
 	color.Println("")
 	color.Println("")
 	color.Println("<fg=green>=====================================</>")
 	color.Printf("<fg=green;op=bold>Xdebug fully set up for %s</>\n", fullContainerName)
 	color.Println("")
-	color.Println("<fg=green>~~ Debugging Web Requests ~~</>")
-	color.Println("")
-	color.Println("<fg=green>- </><fg=green;op=bold;>xdebug_break()</>")
-	color.Println("<fg=green>  in PHP code to set a breakpoint (recommended for Neos/Flow)</>")
-	color.Println("<fg=green>- http://your-url-here/</><fg=green;op=bold;>?XDEBUG_SESSION=1</>")
-	color.Println("<fg=green>  in your HTTP request to debug a single request</>")
-	color.Println("<fg=green>- http://your-url-here/</><fg=green;op=bold;>?XDEBUG_SESSION_START=1</>")
-	color.Println("<fg=green>  in your HTTP request to debug all requests in this session</>")
-	color.Println("<fg=green>  (stop with XDEBUG_SESSION_STOP=1)</>")
-	color.Println("")
-	color.Println("<fg=green>~~ Debugging CLI requests ~~</>")
-	color.Println("")
-	color.Println("<fg=green>- </><fg=green;op=bold;>XDEBUG_SESSION=1</><fg=green> php ...</>")
-	color.Println("<fg=green>  for CLI step Debugging</>")
-	color.Println("")
-	color.Println("<fg=green>~~ Set up PHPStorm/IntelliJ ~~</>")
-	color.Println("<fg=green>- </><fg=green;op=bold;>Run -> Start Listening for PHP Debug Connections</>")
-	color.Println("<fg=green>  needs to be enabled; otherwise connection to the IDE does not work.</>")
-	color.Println("<fg=green>- You need to set up </><fg=green;op=bold;>path mappings</><fg=green> correctly, otherwise you cannot navigate</>")
-	color.Println("<fg=green>  to the files in the IDE when a breakpoint is hit. This can be done as follows:</>")
-	color.Println("")
-	color.Println("<fg=green>  When a breakpoint is hit:</>")
-	color.Println("<fg=green>     Debug Panel -> Threads&Variables</>")
-	color.Println("<fg=green>     -> </><fg=green;op=bold;>Click to set up path mappings</>")
-	color.Println("<fg=green>  When the path mapping is wrongly configured and you need to correct it:</>")
-	color.Println("<fg=green>     Settings</>")
-	color.Println("<fg=green>     -> Languages&Frameworks -> PHP -> Server</>")
-	color.Println("<fg=green>     -> (add server if needed)</>")
-	color.Println("<fg=green>     -> </><fg=green;op=bold;>Use Path Mappings</>")
-	color.Println("")
-	color.Println("<fg=green>~~ Debugging Neos/Flow ~~</>")
-	color.Println("<fg=green>For debugging Neos/Flow, run with </><fg=green;op=bold;>--mount app/Data/Temporary,app/Packages</><fg=green>, because this</>")
-	color.Println("<fg=green>allows to edit all files in the IDE.</>")
-	color.Println("")
-	color.Println("<fg=green>Additionally, enable Power Save Mode in IntelliJ to stop reindexing.</>")
+	color.Printf("<fg=green>  xdebug.mode               = </><fg=green;op=bold;>%s</>\n", xdebug.Mode)
+	color.Printf("<fg=green>  xdebug.client_host        = </><fg=green;op=bold;>%s:%d</>\n", xdebug.ClientHost, xdebug.ClientPort)
+	color.Printf("<fg=green>  xdebug.start_with_request = </><fg=green;op=bold;>%s</>\n", xdebug.StartWithRequest)
+	if xdebug.IdeKey != "" {
+		color.Printf("<fg=green>  xdebug.idekey             = </><fg=green;op=bold;>%s</>\n", xdebug.IdeKey)
+	}
+	if xdebug.LogEnabled() {
+		color.Printf("<fg=green>  xdebug.log                = </><fg=green;op=bold;>%s</>\n", xdebugLogFile)
+	}
+
+	if xdebug.HasMode("debug") {
+		color.Println("")
+		color.Println("<fg=green>~~ Debugging Web Requests ~~</>")
+		color.Println("")
+		color.Println("<fg=green>- </><fg=green;op=bold;>xdebug_break()</>")
+		color.Println("<fg=green>  in PHP code to set a breakpoint (recommended for Neos/Flow)</>")
+		if xdebug.StartsWithRequest("debug") {
+			color.Println("<fg=green>- </><fg=green;op=bold;>every request</><fg=green> connects to the IDE (xdebug.start_with_request = yes)</>")
+		} else {
+			color.Printf("<fg=green>- http://your-url-here/</><fg=green;op=bold;>?XDEBUG_SESSION=%s</>\n", sessionValue)
+			color.Println("<fg=green>  in your HTTP request to debug a single request</>")
+			color.Printf("<fg=green>- http://your-url-here/</><fg=green;op=bold;>?XDEBUG_SESSION_START=%s</>\n", sessionValue)
+			color.Println("<fg=green>  in your HTTP request to debug all requests in this session</>")
+			color.Println("<fg=green>  (stop with XDEBUG_SESSION_STOP=1)</>")
+		}
+		color.Println("")
+		color.Println("<fg=green>~~ Debugging CLI requests ~~</>")
+		color.Println("")
+		if xdebug.StartsWithRequest("debug") {
+			color.Println("<fg=green>- </><fg=green;op=bold;>php ...</>")
+		} else {
+			color.Printf("<fg=green>- </><fg=green;op=bold;>XDEBUG_SESSION=%s</><fg=green> php ...</>\n", sessionValue)
+		}
+		color.Println("<fg=green>  for CLI step Debugging</>")
+		color.Println("")
+		color.Println("<fg=green>~~ Set up PHPStorm/IntelliJ ~~</>")
+		color.Println("<fg=green>- </><fg=green;op=bold;>Run -> Start Listening for PHP Debug Connections</>")
+		color.Printf("<fg=green>  needs to be enabled (on port %d); otherwise connection to the IDE does not work.</>\n", xdebug.ClientPort)
+		color.Println("<fg=green>- You need to set up </><fg=green;op=bold;>path mappings</><fg=green> correctly, otherwise you cannot navigate</>")
+		color.Println("<fg=green>  to the files in the IDE when a breakpoint is hit. This can be done as follows:</>")
+		color.Println("")
+		color.Println("<fg=green>  When a breakpoint is hit:</>")
+		color.Println("<fg=green>     Debug Panel -> Threads&Variables</>")
+		color.Println("<fg=green>     -> </><fg=green;op=bold;>Click to set up path mappings</>")
+		color.Println("<fg=green>  When the path mapping is wrongly configured and you need to correct it:</>")
+		color.Println("<fg=green>     Settings</>")
+		color.Println("<fg=green>     -> Languages&Frameworks -> PHP -> Server</>")
+		color.Println("<fg=green>     -> (add server if needed)</>")
+		color.Println("<fg=green>     -> </><fg=green;op=bold;>Use Path Mappings</>")
+	}
+
+	for _, recording := range []struct{ mode, title string }{{"profile", "Profiling"}, {"trace", "Tracing"}} {
+		if !xdebug.HasMode(recording.mode) {
+			continue
+		}
+		color.Println("")
+		color.Printf("<fg=green>~~ %s ~~</>\n", recording.title)
+		color.Println("")
+		if xdebug.StartsWithRequest(recording.mode) {
+			color.Printf("<fg=green>- </><fg=green;op=bold;>every request</><fg=green> is recorded (%s)</>\n", recording.mode)
+		} else {
+			color.Println("<fg=green>- http://your-url-here/</><fg=green;op=bold;>?XDEBUG_TRIGGER=1</><fg=green> or </><fg=green;op=bold;>XDEBUG_TRIGGER=1</><fg=green> php ...</>")
+			color.Printf("<fg=green>  to record a single request (%s)</>\n", recording.mode)
+		}
+		color.Printf("<fg=green>- the files are written to </><fg=green;op=bold;>%s</><fg=green> in the container, and copied to this machine on Ctrl-C</>\n", xdebugOutputDir)
+	}
+
+	if xdebug.HasMode("coverage") {
+		color.Println("")
+		color.Println("<fg=green>~~ Code Coverage ~~</>")
+		color.Println("")
+		if collectCoverage {
+			color.Println("<fg=green>- the code coverage of </><fg=green;op=bold;>every request</><fg=green> is recorded; click through the application now</>")
+			color.Println("<fg=green>- on Ctrl-C, it is merged into a single file on this machine</>")
+		} else {
+			color.Println("<fg=green>- e.g. </><fg=green;op=bold;>phpunit --coverage-text</><fg=green> now uses Xdebug for code coverage</>")
+		}
+	}
+
+	if xdebug.LogEnabled() {
+		color.Println("")
+		color.Println("<fg=green>~~ Diagnosing connection issues ~~</>")
+		color.Println("")
+		color.Printf("<fg=green>- </><fg=green;op=bold;>drydock execroot %s tail -f %s</>\n", fullContainerName, xdebugLogFile)
+		color.Println("<fg=green>  shows each connection attempt of Xdebug</>")
+	}
+
+	if xdebug.HasMode("debug") {
+		color.Println("")
+		color.Println("<fg=green>~~ Debugging Neos/Flow ~~</>")
+		color.Println("<fg=green>For debugging Neos/Flow, run with </><fg=green;op=bold;>--mount app/Data/Temporary,app/Packages</><fg=green>, because this</>")
+		color.Println("<fg=green>allows to edit all files in the IDE.</>")
+		color.Println("")
+		color.Println("<fg=green>Additionally, enable Power Save Mode in IntelliJ to stop reindexing.</>")
+	}
 	color.Println("<fg=green>=====================================</>")
 	color.Println("")
 	color.Println("<fg=yellow>To stop debugging, </><fg=yellow;op=bold>press Ctrl-C</>")
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gookit/color"
+	"github.com/sandstorm/drydock/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// xdebugOutputDir is xdebug.output_dir inside the container; profiles and traces are written there. It is emptied
+// when Xdebug is installed, so it only contains the files of the current session.
+const xdebugOutputDir = "/tmp/drydock-xdebug"
+
+// xdebugOutputDirPrepareScript creates (or empties) xdebugOutputDir; it must be writable for the PHP user.
+func xdebugOutputDirPrepareScript() string {
+	dir := shellQuote("/container" + xdebugOutputDir)
+	return fmt.Sprintf(`
+mkdir -p %s
+rm -f %s/*
+chmod 1777 %s
+`, dir, dir, dir)
+}
+
+// removeXdebugOutputDir removes xdebugOutputDir from the container, once its files were fetched.
+func removeXdebugOutputDir(target *util.Target, debugImage string, version string) {
+	script := journaledScript(mountSlashContainer+"\nrm -Rf "+shellQuote("/container"+xdebugOutputDir), newJournalEntry("xdebug", util.JournalActionRemove, version, xdebugOutputDir))
+	if err := runHelperScript(target, debugImage, script); err != nil {
+		color.Printf("<fg=yellow>Could not remove %s from the container (drydock cleanup removes it): %s</>\n", xdebugOutputDir, err)
+	}
+}
+
+// fetchXdebugOutputFiles copies the files matching the glob pattern from xdebugOutputDir in the container into
+// localDir, and returns their local paths. The files are streamed as tar through the stdout of the helper container,
+// so this also works for remote docker hosts.
+func fetchXdebugOutputFiles(target *util.Target, debugImage string, pattern string, localDir string) ([]string, error) {
+	script := mountSlashContainer + `
+cd /container` + xdebugOutputDir + ` || exit 0
+set -- ` + pattern + `
+[ -e "$1" ] || exit 0
+tar -cf - "$@"
+`
+	c := helperScriptCommand(target, debugImage, script)
+	c.Stderr = os.Stderr
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	files, extractErr := util.ExtractFlatTar(stdout, localDir)
+	if err := c.Wait(); err != nil {
+		return files, fmt.Errorf("could not copy %s/%s from the container: %w", xdebugOutputDir, pattern, err)
+	}
+	return files, extractErr
+}
+
+// fetchXdebugProfiles copies the cachegrind files to localDir, and prints the top functions of each profile.
+func fetchXdebugProfiles(target *util.Target, debugImage string, localDir string, top int) {
+	files, err := fetchXdebugOutputFiles(target, debugImage, "cachegrind.out.*", localDir)
+	if err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+	}
+	if len(files) == 0 {
+		color.Println("<fg=yellow>No Xdebug profiles were written.</>")
+		return
+	}
+	color.Printf("<green>Copied %d profile(s) to </><fg=green;op=bold;>%s</><green> - open them with KCachegrind, QCachegrind or PHPStorm (Tools -> Analyze Xdebug Profiler Snapshot).</>\n", len(files), localDir)
+
+	if top <= 0 {
+		return
+	}
+	for _, file := range files {
+		profile, err := util.ReadCachegrindFile(file)
+		if err != nil {
+			color.Printf("<fg=yellow>Could not summarize profile: %s</>\n", err)
+			continue
+		}
+		printCachegrindSummary(filepath.Base(file), profile, top)
+	}
+}
+
+func printCachegrindSummary(name string, profile *util.CachegrindProfile, top int) {
+	color.Println("")
+	color.Printf("<op=bold;>%s</> %s\n", name, profile.Command)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "INCLUSIVE\tSELF\tCALLS\t  FUNCTION")
+	for _, function := range profile.TopInclusive(top) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t  %s\n", formatProfileDuration(function.Inclusive), formatProfileDuration(function.Self), function.Calls, function.Name)
+	}
+	w.Flush()
+}
+
+func formatProfileDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+// xdebugTraceSummaryOptions control what is printed for each fetched trace file.
+type xdebugTraceSummaryOptions struct {
+	// Top is the number of functions in the table (by call count); 0 disables it.
+	Top int
+	// TreeDepth is the depth of the printed call tree; 0 disables it.
+	TreeDepth int
+	// Filter only shows functions starting with this prefix (e.g. "Neos\").
+	Filter string
+}
+
+// fetchXdebugTraces copies the trace files to localDir, and prints a summary of each trace.
+func fetchXdebugTraces(target *util.Target, debugImage string, localDir string, options xdebugTraceSummaryOptions) {
+	files, err := fetchXdebugOutputFiles(target, debugImage, "trace.*.xt*", localDir)
+	if err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+	}
+	if len(files) == 0 {
+		color.Println("<fg=yellow>No Xdebug traces were written.</>")
+		return
+	}
+	color.Printf("<green>Copied %d trace(s) to </><fg=green;op=bold;>%s</>\n", len(files), localDir)
+
+	for _, file := range files {
+		trace, err := util.ReadXdebugTraceFile(file)
+		if err != nil {
+			color.Printf("<fg=yellow>Could not summarize trace: %s</>\n", err)
+			continue
+		}
+		printXdebugTraceSummary(filepath.Base(file), trace, options)
+	}
+}
+
+func printXdebugTraceSummary(name string, trace *util.XdebugTrace, options xdebugTraceSummaryOptions) {
+	color.Println("")
+	color.Printf("<op=bold;>%s</>\n", name)
+	if options.Filter != "" {
+		color.Printf("only functions starting with <op=bold;>%s</>\n", options.Filter)
+	}
+
+	if options.Top > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "CALLS\tINCLUSIVE\tSELF\t  FUNCTION")
+		for _, function := range trace.TopFunctions(options.Top, options.Filter) {
+			fmt.Fprintf(w, "%d\t%s\t%s\t  %s\n", function.Calls, formatProfileDuration(function.Inclusive), formatProfileDuration(function.Self), function.Name)
+		}
+		w.Flush()
+	}
+
+	if options.TreeDepth > 0 {
+		root := trace.Root
+		if options.Filter != "" {
+			root = root.Filter(options.Filter)
+		}
+		color.Println("")
+		for _, child := range root.Children {
+			printXdebugTraceNode(child, 0, options.TreeDepth)
+		}
+	}
+}
+
+// printXdebugTraceNode prints the call tree; calls of the same function from the same caller are aggregated.
+func printXdebugTraceNode(node *util.XdebugTraceNode, depth int, maxDepth int) {
+	if depth >= maxDepth {
+		return
+	}
+	calls := ""
+	if node.Calls > 1 {
+		calls = color.Sprintf(" <fg=yellow>%dx</>", node.Calls)
+	}
+	fmt.Printf("%s%s%s  %s\n", strings.Repeat("  ", depth), node.Name, calls, formatProfileDuration(node.Inclusive))
+	for _, child := range node.Children {
+		printXdebugTraceNode(child, depth+1, maxDepth)
+	}
+}
+
+// xdebugCoveragePrependFile is the auto_prepend_file which records the code coverage of each request (as JSON in
+// xdebugOutputDir) with --coverage.
+const xdebugCoveragePrependFile = "/tmp/drydock-xdebug-coverage.php"
+
+// xdebugCoveragePrependScript writes xdebugCoveragePrependFile. An auto_prepend_file configured before (e.g. by
+// drydock excimer) is still included from there, as xdebug.ini overrides it.
+func xdebugCoveragePrependScript(phpBinary string) string {
+	prependFile := shellQuote("/container" + xdebugCoveragePrependFile)
+	return fmt.Sprintf(`
+# var_export() quotes the path as PHP string literal
+PREVIOUS_PREPEND_FILE=$(chroot /container %s -r 'echo var_export((string) ini_get("auto_prepend_file"), true);' 2>/dev/null || true)
+printf '<?php\n$__drydockPreviousPrependFile = %%s;\n' "${PREVIOUS_PREPEND_FILE:-''}" > %s
+cat << 'EOF' >> %s
+// drydock xdebug --coverage: records the code coverage of each request; removed when drydock xdebug ends.
+if (function_exists('xdebug_start_code_coverage')) {
+    xdebug_start_code_coverage(XDEBUG_CC_UNUSED | XDEBUG_CC_DEAD_CODE);
+    register_shutdown_function(function () {
+        $coverage = xdebug_get_code_coverage();
+        xdebug_stop_code_coverage();
+        unset($coverage[__FILE__]);
+        @file_put_contents(sprintf('%s/coverage.%%d.%%s.json', getmypid(), uniqid()), json_encode($coverage));
+    });
+}
+if ($__drydockPreviousPrependFile !== '' && $__drydockPreviousPrependFile !== __FILE__) {
+    require $__drydockPreviousPrependFile;
+}
+unset($__drydockPreviousPrependFile);
+EOF
+chmod 644 %s
+`, shellQuote(phpBinary), prependFile, prependFile, xdebugOutputDir, prependFile)
+}
+
+// fetchXdebugCoverage copies the coverage of all requests from the container, and merges it into a single LCOV or
+// Clover file in localDir; container paths are mapped to host paths via the pathMappings of the configuration.
+func fetchXdebugCoverage(target *util.Target, debugImage string, config util.Config, localDir string, format string) {
+	tempDir, err := os.MkdirTemp("", "drydock-coverage")
+	if err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	files, err := fetchXdebugOutputFiles(target, debugImage, "coverage.*.json", tempDir)
+	if err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+	}
+	if len(files) == 0 {
+		color.Println("<fg=yellow>No code coverage was recorded (no requests?).</>")
+		return
+	}
+
+	coverage := util.Coverage{}
+	for _, file := range files {
+		raw, err := util.ReadXdebugCoverageFile(file)
+		if err != nil {
+			color.Printf("<fg=yellow>Skipping coverage of one request: %s</>\n", err)
+			continue
+		}
+		coverage.Add(raw, config.HostPath)
+	}
+
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+		return
+	}
+	outputFile := filepath.Join(localDir, "coverage.info")
+	if format == xdebugCoverageFormatClover {
+		outputFile = filepath.Join(localDir, "coverage.xml")
+	}
+	output, err := os.Create(outputFile)
+	if err != nil {
+		color.Printf("<red>ERROR: %s</>\n", err)
+		return
+	}
+	defer output.Close()
+	if format == xdebugCoverageFormatClover {
+		err = coverage.WriteClover(output, time.Now())
+	} else {
+		err = coverage.WriteLcov(output)
+	}
+	if err != nil {
+		color.Printf("<red>ERROR: Could not write %s: %s</>\n", outputFile, err)
+		return
+	}
+
+	lines, covered := coverage.Totals()
+	color.Printf("<green>Merged the coverage of %d request(s) into </><fg=green;op=bold;>%s</><green>: %d of %d lines in %d files executed.</>\n", len(files), outputFile, covered, lines, len(coverage))
+}
+
+const (
+	xdebugCoverageFormatLcov   = "lcov"
+	xdebugCoverageFormatClover = "clover"
+)
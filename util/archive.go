@@ -0,0 +1,86 @@
+package util
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ExtractFlatTar writes the regular files of the tar stream into dir (which is created if needed), and returns their
+// paths. Directory structure is dropped, so that a tar stream from a container cannot write outside of dir.
+func ExtractFlatTar(reader io.Reader, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return files, fmt.Errorf("could not read tar stream: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		path := filepath.Join(dir, filepath.Base(header.Name))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return files, err
+		}
+		_, err = io.Copy(file, tarReader)
+		file.Close()
+		if err != nil {
+			return files, fmt.Errorf("could not write %s: %w", path, err)
+		}
+		files = append(files, path)
+	}
+}
+
+// WriteTar writes the directories and regular files below dir as a tar stream; the paths in the stream are relative
+// to dir. Symlinks and other special files are skipped.
+func WriteTar(dir string, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil || relativePath == "." {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relativePath)
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write %s as tar stream: %w", dir, err)
+	}
+	return tarWriter.Close()
+}
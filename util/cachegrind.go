@@ -0,0 +1,218 @@
+package util
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachegrindFunction are the aggregated costs of one function in a cachegrind profile.
+type CachegrindFunction struct {
+	Name string
+	// Calls is the number of calls from other profiled functions ({main} has none).
+	Calls int64
+	Self  time.Duration
+	// Inclusive is Self plus the inclusive time of all calls made; for recursive functions, the time of the
+	// recursive calls is counted multiple times (like in KCachegrind).
+	Inclusive time.Duration
+}
+
+// CachegrindProfile is a profile written by the Xdebug profiler (xdebug.mode=profile).
+type CachegrindProfile struct {
+	// Command is the script (or request URI) which was profiled.
+	Command   string
+	Functions map[string]*CachegrindFunction
+}
+
+// ReadCachegrindFile parses the given cachegrind.out.* file; gzip compressed (.gz) files are supported, as Xdebug
+// compresses profiles by default if it was built with zlib.
+func ReadCachegrindFile(path string) (*CachegrindProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress %s: %w", path, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	profile, err := ParseCachegrind(reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return profile, nil
+}
+
+// ParseCachegrind parses the callgrind format (https://valgrind.org/docs/manual/cl-format.html), as far as it is used
+// by Xdebug: compressed function names "fn=(id) name", and one cost line after each "calls=" line with the inclusive
+// cost of that call. Only the time event is evaluated.
+func ParseCachegrind(reader io.Reader) (*CachegrindProfile, error) {
+	profile := &CachegrindProfile{Functions: map[string]*CachegrindFunction{}}
+	functionNames := map[string]string{}
+	timeEvent := -1
+	timeUnit := time.Microsecond
+
+	var current *CachegrindFunction
+	// callee is set after a "calls=" line; the next cost line is then the inclusive cost of this call.
+	var callee *CachegrindFunction
+	var calleeName string
+
+	function := func(name string) *CachegrindFunction {
+		f, ok := profile.Functions[name]
+		if !ok {
+			f = &CachegrindFunction{Name: name}
+			profile.Functions[name] = f
+		}
+		return f
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, isSpec := strings.Cut(line, "=")
+		if isSpec && !strings.ContainsAny(key, " \t") {
+			switch key {
+			case "fn":
+				name, err := resolveCompressedName(functionNames, value)
+				if err != nil {
+					return nil, err
+				}
+				current = function(name)
+			case "cfn":
+				name, err := resolveCompressedName(functionNames, value)
+				if err != nil {
+					return nil, err
+				}
+				calleeName = name
+			case "calls":
+				if current == nil {
+					return nil, fmt.Errorf("calls= line before any fn= line")
+				}
+				fields := strings.Fields(value)
+				if len(fields) == 0 {
+					return nil, fmt.Errorf("calls= line without a call count")
+				}
+				count, err := strconv.ParseInt(fields[0], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid call count in calls=%s: %w", value, err)
+				}
+				callee = function(calleeName)
+				callee.Calls += count
+			}
+			continue
+		}
+
+		if key, value, isHeader := strings.Cut(line, ": "); isHeader && !isCostLine(line) {
+			switch key {
+			case "cmd":
+				profile.Command = value
+			case "events":
+				timeEvent, timeUnit = parseCachegrindEvents(value)
+			}
+			continue
+		}
+
+		if !isCostLine(line) || current == nil || timeEvent < 0 {
+			continue
+		}
+		fields := strings.Fields(line)
+		// the first field is the position (line number)
+		if len(fields) <= timeEvent+1 {
+			continue
+		}
+		cost, err := strconv.ParseInt(fields[timeEvent+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cost line %q: %w", line, err)
+		}
+		duration := time.Duration(cost) * timeUnit
+
+		if callee != nil {
+			current.Inclusive += duration
+			callee = nil
+		} else {
+			current.Self += duration
+			current.Inclusive += duration
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if timeEvent < 0 {
+		return nil, fmt.Errorf("no time event found in events: header")
+	}
+	return profile, nil
+}
+
+// TopInclusive returns the n functions with the highest inclusive time.
+func (p *CachegrindProfile) TopInclusive(n int) []*CachegrindFunction {
+	functions := make([]*CachegrindFunction, 0, len(p.Functions))
+	for _, f := range p.Functions {
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Inclusive != functions[j].Inclusive {
+			return functions[i].Inclusive > functions[j].Inclusive
+		}
+		return functions[i].Name < functions[j].Name
+	})
+	if n > 0 && len(functions) > n {
+		functions = functions[:n]
+	}
+	return functions
+}
+
+// resolveCompressedName handles name compression: "(id) name" defines id, "(id)" refers to it.
+func resolveCompressedName(names map[string]string, value string) (string, error) {
+	if !strings.HasPrefix(value, "(") {
+		return value, nil
+	}
+	id, name, _ := strings.Cut(value, ")")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name, ok := names[id]
+		if !ok {
+			return "", fmt.Errorf("unknown compressed name %s)", id)
+		}
+		return name, nil
+	}
+	names[id] = name
+	return name, nil
+}
+
+// parseCachegrindEvents returns the index and unit of the time event. Xdebug 3 writes "Time_(10ns)", Xdebug 2 wrote
+// "Time" in microseconds.
+func parseCachegrindEvents(value string) (int, time.Duration) {
+	for i, event := range strings.Fields(value) {
+		if !strings.HasPrefix(event, "Time") {
+			continue
+		}
+		if strings.Contains(event, "(10ns)") {
+			return i, 10 * time.Nanosecond
+		}
+		return i, time.Microsecond
+	}
+	return -1, 0
+}
+
+func isCostLine(line string) bool {
+	first := line[0]
+	return (first >= '0' && first <= '9') || first == '+' || first == '-' || first == '*'
+}
@@ -0,0 +1,223 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cachegrindXdebug3 is a (shortened) profile as written by Xdebug 3: {main} calls strlen() three times.
+const cachegrindXdebug3 = `version: 1
+creator: xdebug 3.3.1 (PHP 8.2.12)
+cmd: /app/index.php
+part: 1
+positions: line
+
+events: Time_(10ns) Memory_(bytes)
+
+fl=(1) php:internal
+fn=(1) php::strlen
+2 100 0
+
+fl=(2) /app/index.php
+fn=(2) {main}
+0 500 64
+cfn=(1)
+calls=3 0 0
+2 300 0
+
+summary: 800 64
+`
+
+// cachegrindXdebug2 is the same profile in the format of Xdebug 2, which measured time in microseconds.
+const cachegrindXdebug2 = `version: 1
+creator: xdebug 2.9.8 (PHP 7.4.33)
+cmd: /app/index.php
+part: 1
+positions: line
+
+events: Time Memory
+
+fl=(1) php:internal
+fn=(1) php::strlen
+2 1 0
+
+fl=(2) /app/index.php
+fn=(2) {main}
+0 5 64
+cfn=(1)
+calls=3 0 0
+2 3 0
+`
+
+func TestParseCachegrind(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantCommand string
+		want        []CachegrindFunction
+		wantErr     string
+	}{
+		{
+			name:        "xdebug 3",
+			input:       cachegrindXdebug3,
+			wantCommand: "/app/index.php",
+			want: []CachegrindFunction{
+				{Name: "{main}", Calls: 0, Self: 5 * time.Microsecond, Inclusive: 8 * time.Microsecond},
+				{Name: "php::strlen", Calls: 3, Self: time.Microsecond, Inclusive: time.Microsecond},
+			},
+		},
+		{
+			name:        "xdebug 2",
+			input:       cachegrindXdebug2,
+			wantCommand: "/app/index.php",
+			want: []CachegrindFunction{
+				{Name: "{main}", Calls: 0, Self: 5 * time.Microsecond, Inclusive: 8 * time.Microsecond},
+				{Name: "php::strlen", Calls: 3, Self: time.Microsecond, Inclusive: time.Microsecond},
+			},
+		},
+		{
+			name:    "calls without count",
+			input:   "events: Time_(10ns)\nfn=(1) {main}\n0 5\ncfn=(1)\ncalls=\n2 3\n",
+			wantErr: "calls= line without a call count",
+		},
+		{
+			name:    "invalid call count",
+			input:   "events: Time_(10ns)\nfn=(1) {main}\n0 5\ncfn=(1)\ncalls=x 0\n2 3\n",
+			wantErr: "invalid call count",
+		},
+		{
+			name:    "calls before fn",
+			input:   "events: Time_(10ns)\ncfn=(1) foo\ncalls=1 0\n",
+			wantErr: "calls= line before any fn= line",
+		},
+		{
+			name:    "invalid cost",
+			input:   "events: Time_(10ns)\nfn=(1) {main}\n0 5x\n",
+			wantErr: "invalid cost line",
+		},
+		{
+			name:    "unknown compressed function name",
+			input:   "events: Time_(10ns)\nfn=(9)\n0 5\n",
+			wantErr: "unknown compressed name (9)",
+		},
+		{
+			name:    "unknown compressed callee name",
+			input:   "events: Time_(10ns)\nfn=(1) {main}\n0 5\ncfn=(2)\ncalls=1 0\n2 3\n",
+			wantErr: "unknown compressed name (2)",
+		},
+		{
+			name:  "unknown compressed file name",
+			input: "events: Time_(10ns)\nfl=(9)\nfn=(1) {main}\n0 500\n",
+			// file names are not evaluated
+			want: []CachegrindFunction{{Name: "{main}", Self: 5 * time.Microsecond, Inclusive: 5 * time.Microsecond}},
+		},
+		{
+			name:    "no time event",
+			input:   "events: Memory_(bytes)\nfn=(1) {main}\n0 5\n",
+			wantErr: "no time event",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile, err := ParseCachegrind(strings.NewReader(test.input))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if profile.Command != test.wantCommand {
+				t.Errorf("Command = %q, want %q", profile.Command, test.wantCommand)
+			}
+			if len(profile.Functions) != len(test.want) {
+				t.Errorf("got %d functions, want %d", len(profile.Functions), len(test.want))
+			}
+			for _, want := range test.want {
+				got, ok := profile.Functions[want.Name]
+				if !ok {
+					t.Errorf("function %s not found", want.Name)
+					continue
+				}
+				if *got != want {
+					t.Errorf("function %s = %+v, want %+v", want.Name, *got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCachegrindProfileTopInclusive(t *testing.T) {
+	profile, err := ParseCachegrind(strings.NewReader(cachegrindXdebug3))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{n: 1, want: []string{"{main}"}},
+		{n: 0, want: []string{"{main}", "php::strlen"}},
+		{n: 5, want: []string{"{main}", "php::strlen"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, function := range profile.TopInclusive(test.n) {
+			got = append(got, function.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("TopInclusive(%d) = %v, want %v", test.n, got, test.want)
+		}
+	}
+}
+
+func TestReadCachegrindFile(t *testing.T) {
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write([]byte(cachegrindXdebug3))
+	gzipWriter.Close()
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		wantErr string
+	}{
+		{name: "plain", file: "cachegrind.out.1", content: []byte(cachegrindXdebug3)},
+		{name: "gzip compressed", file: "cachegrind.out.1.gz", content: gzipped.Bytes()},
+		{name: "not gzip compressed", file: "cachegrind.out.1.gz", content: []byte(cachegrindXdebug3), wantErr: "could not decompress"},
+		{name: "truncated gzip", file: "cachegrind.out.1.gz", content: gzipped.Bytes()[:gzipped.Len()/2], wantErr: "could not parse"},
+		{name: "not a profile", file: "cachegrind.out.1", content: []byte("<?php echo 'hello';\n"), wantErr: "no time event"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), test.file)
+			if err := os.WriteFile(file, test.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadCachegrindFile(file)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if main := got.Functions["{main}"]; main == nil || main.Inclusive != 8*time.Microsecond {
+				t.Errorf("{main} = %+v, want 8µs inclusive", main)
+			}
+		})
+	}
+}
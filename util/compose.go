@@ -0,0 +1,122 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ComposeOptions are the global docker compose flags, passed through when looking up compose services. They allow
+// to target a service from outside the directory containing the compose file.
+type ComposeOptions struct {
+	ProjectName      string
+	Files            []string
+	ProjectDirectory string
+}
+
+func (o ComposeOptions) globalArgs() []string {
+	var args []string
+	if o.ProjectName != "" {
+		args = append(args, "--project-name", o.ProjectName)
+	}
+	for _, file := range o.Files {
+		args = append(args, "--file", file)
+	}
+	if o.ProjectDirectory != "" {
+		args = append(args, "--project-directory", o.ProjectDirectory)
+	}
+	return args
+}
+
+// ProjectNameOrDefault infers the compose project name the same way docker compose does: --project-name wins, then
+// COMPOSE_PROJECT_NAME, then the name of the project directory (or the directory of the first compose file, or the
+// current working directory).
+func (o ComposeOptions) ProjectNameOrDefault() string {
+	if o.ProjectName != "" {
+		return normalizeComposeProjectName(o.ProjectName)
+	}
+	if name := os.Getenv("COMPOSE_PROJECT_NAME"); name != "" {
+		return normalizeComposeProjectName(name)
+	}
+
+	dir := o.ProjectDirectory
+	if dir == "" && len(o.Files) > 0 {
+		dir = filepath.Dir(o.Files[0])
+	}
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	absDir, err := filepath.Abs(dir)
+	if err == nil {
+		dir = absDir
+	}
+	return normalizeComposeProjectName(filepath.Base(dir))
+}
+
+var invalidComposeProjectNameChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// normalizeComposeProjectName mirrors the normalization of docker compose v2: lowercase, and only [a-z0-9_-];
+// starting with a letter or digit.
+func normalizeComposeProjectName(name string) string {
+	name = invalidComposeProjectNameChars.ReplaceAllString(strings.ToLower(name), "")
+	return strings.TrimLeft(name, "_-")
+}
+
+type detectedComposeCommand struct {
+	command []string
+	err     error
+}
+
+var (
+	composeCommands     = map[string]detectedComposeCommand{}
+	composeCommandsLock sync.Mutex
+)
+
+// DetectComposeCommand returns the command to run compose for the given runtime: "docker compose" (Compose v2) if the
+// plugin is installed, and the legacy "docker-compose" binary (Compose v1) otherwise; for Podman, "podman compose"
+// or "podman-compose".
+func DetectComposeCommand(runtimeName string) ([]string, error) {
+	composeCommandsLock.Lock()
+	defer composeCommandsLock.Unlock()
+	if detected, ok := composeCommands[runtimeName]; ok {
+		return detected.command, detected.err
+	}
+
+	standalone := "docker-compose"
+	if runtimeName == RuntimePodman {
+		standalone = "podman-compose"
+	}
+	var detected detectedComposeCommand
+	if exec.Command(runtimeName, "compose", "version").Run() == nil {
+		detected.command = []string{runtimeName, "compose"}
+	} else if _, err := exec.LookPath(standalone); err == nil {
+		detected.command = []string{standalone}
+	} else {
+		detected.err = fmt.Errorf("neither %s compose nor %s is installed", runtimeName, standalone)
+	}
+	composeCommands[runtimeName] = detected
+	return detected.command, detected.err
+}
+
+// ComposeServiceContainerIds returns the IDs of all running containers of the given compose service, using the
+// compose command of the given runtime.
+func ComposeServiceContainerIds(runtimeName string, options ComposeOptions, service string) ([]string, error) {
+	command, err := DetectComposeCommand(runtimeName)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{}, command[1:]...)
+	args = append(args, options.globalArgs()...)
+	args = append(args, "ps", "-q", service)
+
+	output, err := ExecCommand(command[0], args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not run %s ps: %w", strings.Join(command, " "), err)
+	}
+	return strings.Fields(output), nil
+}
@@ -0,0 +1,304 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ProjectConfigFileName is searched in the current directory and all parent directories.
+const ProjectConfigFileName = ".drydock.yaml"
+
+// Config are the drydock defaults, loaded from the user config (~/.config/drydock/config.yaml) and the project
+// config (.drydock.yaml). Empty values mean "not configured".
+type Config struct {
+	// DebugImage is the image used for the nsenter helper container
+	DebugImage string       `yaml:"debugImage,omitempty"`
+	Php        PhpConfig    `yaml:"php,omitempty"`
+	Xdebug     XdebugConfig `yaml:"xdebug,omitempty"`
+	Spx        SpxConfig    `yaml:"spx,omitempty"`
+	// PathMappings maps paths inside the container to paths on the host (relative host paths are resolved
+	// relative to the config file).
+	PathMappings map[string]string `yaml:"pathMappings,omitempty"`
+	// Services contains overrides per docker compose service (or container name).
+	Services map[string]Config `yaml:"services,omitempty"`
+}
+
+type PhpConfig struct {
+	// IniDir overrides the ini scan dirs detected by the PHP probe; ini files are written to IniDir/conf.d
+	IniDir string `yaml:"iniDir,omitempty"`
+	// Reload is the reload strategy (see drydock xdebug --reload); empty means auto, chosen from the detected SAPI
+	Reload string `yaml:"reload,omitempty"`
+	// ReloadCommand is run inside the container to make PHP pick up new ini files, instead of the reload strategy
+	ReloadCommand string `yaml:"reloadCommand,omitempty"`
+	// RestartWorkers is a regular expression for long-running PHP CLI workers to restart after the reload
+	RestartWorkers string `yaml:"restartWorkers,omitempty"`
+}
+
+type XdebugConfig struct {
+	// Mode is xdebug.mode, a comma separated list of XdebugModes (e.g. "develop,debug")
+	Mode       string `yaml:"mode,omitempty"`
+	ClientHost string `yaml:"clientHost,omitempty"`
+	ClientPort int    `yaml:"clientPort,omitempty"`
+	IdeKey     string `yaml:"idekey,omitempty"`
+	// StartWithRequest is xdebug.start_with_request: trigger, yes or default (which depends on the mode)
+	StartWithRequest string `yaml:"startWithRequest,omitempty"`
+	// Log enables xdebug.log inside the container, to diagnose connection issues; nil if not set, so that a service
+	// override can set it to false
+	Log *bool `yaml:"log,omitempty"`
+	// Relay forwards Xdebug connections through the container runtime (see drydock xdebug --relay); nil if not
+	// set, so that a service override can set it to false
+	Relay *bool `yaml:"relay,omitempty"`
+}
+
+// LogEnabled is true if xdebug.log is enabled.
+func (x XdebugConfig) LogEnabled() bool {
+	return x.Log != nil && *x.Log
+}
+
+// XdebugModes are the values which can be combined in xdebug.mode.
+var XdebugModes = []string{"off", "develop", "coverage", "debug", "gcstats", "profile", "trace"}
+
+// XdebugStartWithRequestValues are the supported values of xdebug.start_with_request.
+var XdebugStartWithRequestValues = []string{"trigger", "yes", "default"}
+
+// Validate checks mode and start_with_request, as a typo there silently disables Xdebug.
+func (x XdebugConfig) Validate() error {
+	for _, mode := range x.Modes() {
+		if !slices.Contains(XdebugModes, mode) {
+			return fmt.Errorf("unknown xdebug mode %q - must be a comma separated list of %s", mode, strings.Join(XdebugModes, ", "))
+		}
+	}
+	if len(x.Modes()) == 0 {
+		return fmt.Errorf("xdebug mode must not be empty")
+	}
+	if !slices.Contains(XdebugStartWithRequestValues, x.StartWithRequest) {
+		return fmt.Errorf("unknown xdebug start_with_request %q - must be one of %s", x.StartWithRequest, strings.Join(XdebugStartWithRequestValues, ", "))
+	}
+	if x.ClientPort <= 0 || x.ClientPort > 65535 {
+		return fmt.Errorf("invalid xdebug client port %d", x.ClientPort)
+	}
+	return nil
+}
+
+// Modes returns the entries of Mode.
+func (x XdebugConfig) Modes() []string {
+	var modes []string
+	for _, mode := range strings.Split(x.Mode, ",") {
+		if mode = strings.TrimSpace(mode); mode != "" {
+			modes = append(modes, mode)
+		}
+	}
+	return modes
+}
+
+func (x XdebugConfig) HasMode(mode string) bool {
+	return slices.Contains(x.Modes(), mode)
+}
+
+// StartsWithRequest returns whether the given mode is active for every request (and not only if triggered, e.g. via
+// XDEBUG_SESSION or XDEBUG_TRIGGER). For start_with_request=default, this is only the case for profile.
+func (x XdebugConfig) StartsWithRequest(mode string) bool {
+	switch x.StartWithRequest {
+	case "yes":
+		return true
+	case "default":
+		return mode == "profile"
+	default:
+		return false
+	}
+}
+
+type SpxConfig struct {
+	Key string `yaml:"key,omitempty"`
+}
+
+// DefaultConfig contains the built-in defaults, which are overridden by the config files.
+func DefaultConfig() Config {
+	return Config{
+		DebugImage: "nicolaka/netshoot",
+		Xdebug: XdebugConfig{
+			Mode:             "develop,debug",
+			ClientHost:       "host.docker.internal",
+			ClientPort:       9003,
+			StartWithRequest: "default",
+		},
+		Spx: SpxConfig{
+			Key: "dev",
+		},
+	}
+}
+
+// LoadConfig merges the defaults, the user config and the nearest .drydock.yaml above dir. It also returns the
+// config files which were found.
+func LoadConfig(dir string) (Config, []string, error) {
+	config := DefaultConfig()
+	var loadedFiles []string
+
+	candidates := []string{}
+	if userConfig := userConfigFile(); userConfig != "" {
+		candidates = append(candidates, userConfig)
+	}
+	if projectConfig := findProjectConfigFile(dir); projectConfig != "" {
+		candidates = append(candidates, projectConfig)
+	}
+
+	for _, file := range candidates {
+		fileConfig, err := readConfigFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Config{}, nil, err
+		}
+		config = config.Merge(fileConfig)
+		loadedFiles = append(loadedFiles, file)
+	}
+	return config, loadedFiles, nil
+}
+
+// ForService returns the config with the overrides for the given service (or container name) applied.
+func (c Config) ForService(service string) Config {
+	serviceConfig, ok := c.Services[service]
+	if !ok {
+		return c
+	}
+	serviceConfig.Services = nil
+	return c.Merge(serviceConfig)
+}
+
+// Merge returns c, with all values set in other taking precedence.
+func (c Config) Merge(other Config) Config {
+	result := c
+	result.DebugImage = firstNonEmpty(other.DebugImage, c.DebugImage)
+	result.Php.IniDir = firstNonEmpty(other.Php.IniDir, c.Php.IniDir)
+	result.Php.Reload = firstNonEmpty(other.Php.Reload, c.Php.Reload)
+	result.Php.ReloadCommand = firstNonEmpty(other.Php.ReloadCommand, c.Php.ReloadCommand)
+	result.Php.RestartWorkers = firstNonEmpty(other.Php.RestartWorkers, c.Php.RestartWorkers)
+	result.Xdebug.Mode = firstNonEmpty(other.Xdebug.Mode, c.Xdebug.Mode)
+	result.Xdebug.ClientHost = firstNonEmpty(other.Xdebug.ClientHost, c.Xdebug.ClientHost)
+	if other.Xdebug.ClientPort != 0 {
+		result.Xdebug.ClientPort = other.Xdebug.ClientPort
+	}
+	result.Xdebug.IdeKey = firstNonEmpty(other.Xdebug.IdeKey, c.Xdebug.IdeKey)
+	result.Xdebug.StartWithRequest = firstNonEmpty(other.Xdebug.StartWithRequest, c.Xdebug.StartWithRequest)
+	if other.Xdebug.Log != nil {
+		result.Xdebug.Log = other.Xdebug.Log
+	}
+	if other.Xdebug.Relay != nil {
+		result.Xdebug.Relay = other.Xdebug.Relay
+	}
+	result.Spx.Key = firstNonEmpty(other.Spx.Key, c.Spx.Key)
+
+	result.PathMappings = map[string]string{}
+	for containerPath, hostPath := range c.PathMappings {
+		result.PathMappings[containerPath] = hostPath
+	}
+	for containerPath, hostPath := range other.PathMappings {
+		result.PathMappings[containerPath] = hostPath
+	}
+
+	result.Services = map[string]Config{}
+	for service, serviceConfig := range c.Services {
+		result.Services[service] = serviceConfig
+	}
+	for service, serviceConfig := range other.Services {
+		if existing, ok := result.Services[service]; ok {
+			serviceConfig = existing.Merge(serviceConfig)
+		}
+		result.Services[service] = serviceConfig
+	}
+	return result
+}
+
+// HostPath maps a path inside the container to the host via PathMappings (longest matching container path wins); if
+// no mapping matches, the path is returned unchanged.
+func (c Config) HostPath(containerPath string) string {
+	bestMatch := ""
+	bestPrefix := ""
+	found := false
+	for mappedPath := range c.PathMappings {
+		// a mapping of "/" becomes the empty prefix, which matches every absolute path.
+		prefix := strings.TrimSuffix(mappedPath, "/")
+		if (containerPath == prefix || strings.HasPrefix(containerPath, prefix+"/")) && (!found || len(prefix) > len(bestPrefix)) {
+			bestMatch = mappedPath
+			bestPrefix = prefix
+			found = true
+		}
+	}
+	if !found {
+		return containerPath
+	}
+	return filepath.Join(c.PathMappings[bestMatch], strings.TrimPrefix(containerPath, bestPrefix))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func readConfigFile(file string) (Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("could not parse %s: %w", file, err)
+	}
+
+	config.resolvePathMappings(filepath.Dir(file))
+	return config, nil
+}
+
+// resolvePathMappings makes relative host paths absolute, relative to the directory of the config file.
+func (c *Config) resolvePathMappings(baseDir string) {
+	for containerPath, hostPath := range c.PathMappings {
+		if !filepath.IsAbs(hostPath) {
+			c.PathMappings[containerPath] = filepath.Join(baseDir, hostPath)
+		}
+	}
+	for service, serviceConfig := range c.Services {
+		serviceConfig.resolvePathMappings(baseDir)
+		c.Services[service] = serviceConfig
+	}
+}
+
+func userConfigFile() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "drydock", "config.yaml")
+}
+
+// findProjectConfigFile walks up from dir, and returns the first .drydock.yaml found (or "").
+func findProjectConfigFile(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, ProjectConfigFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
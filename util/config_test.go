@@ -0,0 +1,81 @@
+package util
+
+import "testing"
+
+func TestConfigHostPath(t *testing.T) {
+	tests := []struct {
+		name          string
+		pathMappings  map[string]string
+		containerPath string
+		want          string
+	}{
+		{
+			name:          "no mappings",
+			containerPath: "/app/src/Foo.php",
+			want:          "/app/src/Foo.php",
+		},
+		{
+			name:          "no mapping matches",
+			pathMappings:  map[string]string{"/app": "/home/me/project"},
+			containerPath: "/vendor/Foo.php",
+			want:          "/vendor/Foo.php",
+		},
+		{
+			name:          "prefix of a path component does not match",
+			pathMappings:  map[string]string{"/app": "/home/me/project"},
+			containerPath: "/application/Foo.php",
+			want:          "/application/Foo.php",
+		},
+		{
+			name:          "mapped directory",
+			pathMappings:  map[string]string{"/app": "/home/me/project"},
+			containerPath: "/app/src/Foo.php",
+			want:          "/home/me/project/src/Foo.php",
+		},
+		{
+			name:          "the mapped directory itself",
+			pathMappings:  map[string]string{"/app": "/home/me/project"},
+			containerPath: "/app",
+			want:          "/home/me/project",
+		},
+		{
+			name:          "trailing slash in the mapping",
+			pathMappings:  map[string]string{"/app/": "/home/me/project/"},
+			containerPath: "/app/src/Foo.php",
+			want:          "/home/me/project/src/Foo.php",
+		},
+		{
+			name: "longest mapping wins",
+			pathMappings: map[string]string{
+				"/app":          "/home/me/project",
+				"/app/Packages": "/home/me/packages",
+			},
+			containerPath: "/app/Packages/Neos/Foo.php",
+			want:          "/home/me/packages/Neos/Foo.php",
+		},
+		{
+			name:          "root mapping",
+			pathMappings:  map[string]string{"/": "/home/me/container-root"},
+			containerPath: "/app/src/Foo.php",
+			want:          "/home/me/container-root/app/src/Foo.php",
+		},
+		{
+			name: "more specific mapping wins over the root mapping",
+			pathMappings: map[string]string{
+				"/":    "/home/me/container-root",
+				"/app": "/home/me/project",
+			},
+			containerPath: "/app/src/Foo.php",
+			want:          "/home/me/project/src/Foo.php",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{PathMappings: test.pathMappings}
+			if got := config.HostPath(test.containerPath); got != test.want {
+				t.Errorf("HostPath(%q) = %q, want %q", test.containerPath, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package util
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line states in the result of xdebug_get_code_coverage() (with XDEBUG_CC_UNUSED | XDEBUG_CC_DEAD_CODE).
+const (
+	xdebugCoverageExecuted    = 1
+	xdebugCoverageNotExecuted = -1
+)
+
+// Coverage is the merged line coverage of several requests: file -> line -> number of requests which executed it.
+// Lines which are executable but were never executed have a count of 0.
+type Coverage map[string]map[int]int
+
+// ReadXdebugCoverageFile reads the JSON encoded result of xdebug_get_code_coverage() of one request.
+func ReadXdebugCoverageFile(path string) (map[string]map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// json_encode() writes empty PHP arrays as [] instead of {}; for the whole result and per file.
+	if isEmptyJsonArray(data) {
+		return nil, nil
+	}
+	var files map[string]json.RawMessage
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	raw := map[string]map[string]int{}
+	for file, linesJson := range files {
+		if isEmptyJsonArray(linesJson) {
+			continue
+		}
+		var lines map[string]int
+		if err := json.Unmarshal(linesJson, &lines); err != nil {
+			return nil, fmt.Errorf("could not parse the coverage of %s in %s: %w", file, path, err)
+		}
+		raw[file] = lines
+	}
+	return raw, nil
+}
+
+func isEmptyJsonArray(data []byte) bool {
+	return strings.TrimSpace(string(data)) == "[]"
+}
+
+// Add merges the coverage of one request; files are translated with mapPath (e.g. from container to host paths).
+func (c Coverage) Add(raw map[string]map[string]int, mapPath func(string) string) {
+	for file, lines := range raw {
+		file = mapPath(file)
+		if c[file] == nil {
+			c[file] = map[int]int{}
+		}
+		for lineString, state := range lines {
+			line, err := strconv.Atoi(lineString)
+			if err != nil {
+				continue
+			}
+			switch state {
+			case xdebugCoverageExecuted:
+				c[file][line]++
+			case xdebugCoverageNotExecuted:
+				if _, ok := c[file][line]; !ok {
+					c[file][line] = 0
+				}
+			}
+		}
+	}
+}
+
+// Files returns the covered files, sorted.
+func (c Coverage) Files() []string {
+	files := make([]string, 0, len(c))
+	for file := range c {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (c Coverage) sortedLines(file string) []int {
+	lines := make([]int, 0, len(c[file]))
+	for line := range c[file] {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Totals returns the number of executable and of executed lines.
+func (c Coverage) Totals() (lines int, covered int) {
+	for _, fileLines := range c {
+		for _, count := range fileLines {
+			lines++
+			if count > 0 {
+				covered++
+			}
+		}
+	}
+	return lines, covered
+}
+
+// WriteLcov writes the coverage in the LCOV tracefile format (as read by genhtml and most IDEs).
+func (c Coverage) WriteLcov(w io.Writer) error {
+	for _, file := range c.Files() {
+		if _, err := fmt.Fprintf(w, "TN:\nSF:%s\n", file); err != nil {
+			return err
+		}
+		covered := 0
+		for _, line := range c.sortedLines(file) {
+			count := c[file][line]
+			if count > 0 {
+				covered++
+			}
+			fmt.Fprintf(w, "DA:%d,%d\n", line, count)
+		}
+		if _, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(c[file]), covered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cloverCoverage struct {
+	XMLName   xml.Name      `xml:"coverage"`
+	Generated int64         `xml:"generated,attr"`
+	Project   cloverProject `xml:"project"`
+}
+
+type cloverProject struct {
+	Timestamp int64         `xml:"timestamp,attr"`
+	Files     []cloverFile  `xml:"file"`
+	Metrics   cloverMetrics `xml:"metrics"`
+}
+
+type cloverFile struct {
+	Name    string        `xml:"name,attr"`
+	Lines   []cloverLine  `xml:"line"`
+	Metrics cloverMetrics `xml:"metrics"`
+}
+
+type cloverLine struct {
+	Num   int    `xml:"num,attr"`
+	Type  string `xml:"type,attr"`
+	Count int    `xml:"count,attr"`
+}
+
+type cloverMetrics struct {
+	Files             int `xml:"files,attr,omitempty"`
+	Statements        int `xml:"statements,attr"`
+	CoveredStatements int `xml:"coveredstatements,attr"`
+}
+
+// WriteClover writes the coverage as Clover XML (statement coverage only).
+func (c Coverage) WriteClover(w io.Writer, generated time.Time) error {
+	project := cloverProject{Timestamp: generated.Unix()}
+	for _, file := range c.Files() {
+		cloverFile := cloverFile{Name: file}
+		for _, line := range c.sortedLines(file) {
+			count := c[file][line]
+			cloverFile.Lines = append(cloverFile.Lines, cloverLine{Num: line, Type: "stmt", Count: count})
+			cloverFile.Metrics.Statements++
+			if count > 0 {
+				cloverFile.Metrics.CoveredStatements++
+			}
+		}
+		project.Files = append(project.Files, cloverFile)
+		project.Metrics.Statements += cloverFile.Metrics.Statements
+		project.Metrics.CoveredStatements += cloverFile.Metrics.CoveredStatements
+	}
+	project.Metrics.Files = len(project.Files)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(cloverCoverage{Generated: generated.Unix(), Project: project}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
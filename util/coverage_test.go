@@ -0,0 +1,208 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadXdebugCoverageFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]map[string]int
+		wantErr string
+	}{
+		{
+			name:    "lines per file",
+			content: `{"/app/index.php": {"3": 1, "4": -1, "5": -2}, "/app/src/Foo.php": {"10": 1}}`,
+			want: map[string]map[string]int{
+				"/app/index.php":   {"3": 1, "4": -1, "5": -2},
+				"/app/src/Foo.php": {"10": 1},
+			},
+		},
+		{
+			name:    "no coverage at all",
+			content: `[]`,
+			want:    nil,
+		},
+		{
+			name:    "file without lines",
+			content: `{"/app/index.php": {"3": 1}, "/app/empty.php": []}`,
+			want: map[string]map[string]int{
+				"/app/index.php": {"3": 1},
+			},
+		},
+		{
+			name:    "invalid JSON",
+			content: `{"/app/index.php": `,
+			wantErr: "could not parse",
+		},
+		{
+			name:    "invalid lines of a file",
+			content: `{"/app/index.php": "executed"}`,
+			wantErr: "could not parse the coverage of /app/index.php",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "coverage.1.json")
+			if err := os.WriteFile(file, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadXdebugCoverageFile(file)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadXdebugCoverageFileMissing(t *testing.T) {
+	_, err := ReadXdebugCoverageFile(filepath.Join(t.TempDir(), "coverage.1.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestCoverageAdd(t *testing.T) {
+	mapPath := func(path string) string {
+		return strings.Replace(path, "/app/", "/home/me/project/", 1)
+	}
+
+	tests := []struct {
+		name     string
+		requests []map[string]map[string]int
+		want     Coverage
+	}{
+		{
+			name: "executed, not executed and dead lines",
+			requests: []map[string]map[string]int{
+				{"/app/index.php": {"3": 1, "4": -1, "5": -2}},
+			},
+			want: Coverage{"/home/me/project/index.php": {3: 1, 4: 0}},
+		},
+		{
+			name: "executed lines are counted per request",
+			requests: []map[string]map[string]int{
+				{"/app/index.php": {"3": 1, "4": -1}},
+				{"/app/index.php": {"3": 1, "4": 1}},
+				{"/app/index.php": {"3": 1, "4": -1}},
+			},
+			want: Coverage{"/home/me/project/index.php": {3: 3, 4: 1}},
+		},
+		{
+			name: "invalid line numbers are skipped",
+			requests: []map[string]map[string]int{
+				{"/app/index.php": {"3": 1, "x": 1}},
+			},
+			want: Coverage{"/home/me/project/index.php": {3: 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			coverage := Coverage{}
+			for _, raw := range test.requests {
+				coverage.Add(raw, mapPath)
+			}
+			if !reflect.DeepEqual(coverage, test.want) {
+				t.Errorf("got %v, want %v", coverage, test.want)
+			}
+		})
+	}
+}
+
+// coverageFixture covers two files: index.php with 2 of 3 lines executed, Foo.php with none of 1.
+var coverageFixture = Coverage{
+	"/app/src/Foo.php": {10: 0},
+	"/app/index.php":   {3: 2, 4: 0, 5: 1},
+}
+
+func TestCoverageTotals(t *testing.T) {
+	lines, covered := coverageFixture.Totals()
+	if lines != 4 || covered != 2 {
+		t.Errorf("Totals() = %d, %d - want 4, 2", lines, covered)
+	}
+}
+
+func TestCoverageWriters(t *testing.T) {
+	generated := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		write func(c Coverage, w *strings.Builder) error
+		want  string
+	}{
+		{
+			name: "lcov",
+			write: func(c Coverage, w *strings.Builder) error {
+				return c.WriteLcov(w)
+			},
+			want: `TN:
+SF:/app/index.php
+DA:3,2
+DA:4,0
+DA:5,1
+LF:3
+LH:2
+end_of_record
+TN:
+SF:/app/src/Foo.php
+DA:10,0
+LF:1
+LH:0
+end_of_record
+`,
+		},
+		{
+			name: "clover",
+			write: func(c Coverage, w *strings.Builder) error {
+				return c.WriteClover(w, generated)
+			},
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<coverage generated="1705312800">
+  <project timestamp="1705312800">
+    <file name="/app/index.php">
+      <line num="3" type="stmt" count="2"></line>
+      <line num="4" type="stmt" count="0"></line>
+      <line num="5" type="stmt" count="1"></line>
+      <metrics statements="3" coveredstatements="2"></metrics>
+    </file>
+    <file name="/app/src/Foo.php">
+      <line num="10" type="stmt" count="0"></line>
+      <metrics statements="1" coveredstatements="0"></metrics>
+    </file>
+    <metrics files="2" statements="4" coveredstatements="2"></metrics>
+  </project>
+</coverage>
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output strings.Builder
+			if err := test.write(coverageFixture, &output); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if output.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", output.String(), test.want)
+			}
+		})
+	}
+}
@@ -2,17 +2,10 @@ package util
 
 import (
 	"bytes"
-	"encoding/json"
-	"fmt"
 	"os/exec"
-	"strconv"
 	"strings"
 )
 
-func TryGetDockerContainerNameFromDockerCompose(possibleComposeServiceName string) (string, error) {
-	return ExecCommand("docker-compose", "ps", "-q", possibleComposeServiceName)
-}
-
 func ExecCommand(command string, args ...string) (string, error) {
 	cmd := exec.Command(command, args...)
 	var out bytes.Buffer
@@ -23,62 +16,23 @@ func ExecCommand(command string, args ...string) (string, error) {
 	return strings.TrimSpace(out.String()), nil
 }
 
-func dockerInspect(containerName string, format string) (string, error) {
-	return ExecCommand("docker", "container", "inspect", "--format", format, containerName)
-}
-
-func GetRootPidForDockerContainer(containerName string) (string, error) {
-	return dockerInspect(containerName, "{{.State.Pid}}")
-}
-
-func GetEnvCliCallsForDockerRunFromContainerMetadata(containerName string) ([]string, error) {
+// EnvCliCallsForDockerRun converts KEY=value pairs into "--env KEY=value" arguments for "docker run".
+func EnvCliCallsForDockerRun(env []string) []string {
 	var dockerRunCommand []string
-	envAsJsonString, err := dockerInspect(containerName, "{{json .Config.Env}}")
-	if err != nil {
-		return nil, fmt.Errorf("could not run docker inspect: %w", err)
-	}
-
-	var parsedEnv []string
-	err = json.Unmarshal([]byte(envAsJsonString), &parsedEnv)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse JSON result of docker inspect %s - nested error: %w", envAsJsonString, err)
-	}
-
-	for _, s := range parsedEnv {
+	for _, s := range env {
 		dockerRunCommand = append(dockerRunCommand, "--env", s)
 	}
-
-	return dockerRunCommand, nil
-}
-
-type dockerPorts struct {
-	HostIp   string
-	HostPort string
+	return dockerRunCommand
 }
 
-func GetHostPorts(containerName string) ([]int, error) {
-	envAsJsonString, err := dockerInspect(containerName, "{{json .NetworkSettings.Ports}}")
-	if err != nil {
-		return nil, fmt.Errorf("could not run docker inspect: %w", err)
-	}
-
-	var parsedEnv map[string][]dockerPorts
-	err = json.Unmarshal([]byte(envAsJsonString), &parsedEnv)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse JSON result of docker inspect %s - nested error: %w", envAsJsonString, err)
-	}
-
-	var result []int
-	for _, s := range parsedEnv {
-		for _, inner := range s {
-			tmp, _ := strconv.Atoi(inner.HostPort)
-			result = append(result, tmp)
+// LookupEnv returns the value of key in a list of KEY=value pairs (as in the container config). Like with
+// "docker run --env", the last occurrence wins.
+func LookupEnv(env []string, key string) (string, bool) {
+	value, found := "", false
+	for _, s := range env {
+		if k, v, ok := strings.Cut(s, "="); ok && k == key {
+			value, found = v, true
 		}
 	}
-
-	return result, nil
-}
-
-func GetFullContainerName(containerName string) (string, error) {
-	return dockerInspect(containerName, "{{.Name}}")
+	return value, found
 }
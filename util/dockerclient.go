@@ -0,0 +1,526 @@
+package util
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dockerApiVersion is the Engine API version we speak. 1.41 is supported by every Docker release since 20.10
+// and by the Docker compatible API of Podman.
+const dockerApiVersion = "v1.41"
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// ErrNoSuchContainer is returned (wrapped) by the DockerClient if the daemon does not know the given container.
+var ErrNoSuchContainer = errors.New("no such container")
+
+// DockerClient is a minimal client for the Docker Engine API. It talks to the daemon socket directly instead
+// of forking the docker CLI, so that we get typed results and the real error messages of the daemon.
+type DockerClient struct {
+	// Host is the endpoint we talk to, in the same format as DOCKER_HOST (unix://, tcp://, ssh://)
+	Host string
+
+	httpClient *http.Client
+	baseUrl    string
+}
+
+// NewDockerClientFromEnv creates a client for the daemon the docker CLI would talk to: DOCKER_HOST wins, then the
+// docker context selected via DOCKER_CONTEXT or the currentContext in ~/.docker/config.json.
+func NewDockerClientFromEnv() (*DockerClient, error) {
+	host, err := DockerHostFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewDockerClient(host)
+}
+
+// NewDockerClient creates a client for the given DOCKER_HOST style endpoint.
+func NewDockerClient(host string) (*DockerClient, error) {
+	return newApiClient(host, []string{"docker", "system", "dial-stdio"})
+}
+
+// NewPodmanClient creates a client for the Docker compatible API of Podman at the given CONTAINER_HOST style
+// endpoint. For ssh://, the socket path of the URL (e.g. ssh://user@host/run/user/1000/podman/podman.sock) is used on
+// the remote host.
+func NewPodmanClient(host string) (*DockerClient, error) {
+	dialStdio := []string{"podman", "system", "dial-stdio"}
+	if u, err := url.Parse(host); err == nil && u.Scheme == "ssh" && u.Path != "" {
+		dialStdio = append([]string{"env", "CONTAINER_HOST=unix://" + u.Path}, dialStdio...)
+	}
+	return newApiClient(host, dialStdio)
+}
+
+// newApiClient creates the client; for ssh:// endpoints, dialStdio is run on the remote host to reach the API.
+func newApiClient(host string, dialStdio []string) (*DockerClient, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse docker host %s: %w", host, err)
+	}
+
+	transport := &http.Transport{
+		IdleConnTimeout: 30 * time.Second,
+	}
+	baseUrl := "http://docker"
+
+	switch u.Scheme {
+	case "unix":
+		socketPath := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+	case "tcp":
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			tlsConfig, err := dockerTlsConfigFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+			baseUrl = "https://" + u.Host
+		} else {
+			baseUrl = "http://" + u.Host
+		}
+	case "ssh":
+		// same trick as the docker CLI: run "docker system dial-stdio" (or "podman system dial-stdio") on the remote
+		// host, and speak HTTP over stdin/stdout of the SSH process.
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialSshDocker(u, dialStdio)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported docker host %s - only unix://, tcp:// and ssh:// are supported", host)
+	}
+
+	return &DockerClient{
+		Host:       host,
+		httpClient: &http.Client{Transport: transport},
+		baseUrl:    baseUrl,
+	}, nil
+}
+
+// DockerHostFromEnv returns the endpoint of the active docker daemon, resolving DOCKER_HOST and docker contexts.
+func DockerHostFromEnv() (string, error) {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host, nil
+	}
+
+	contextName, err := currentDockerContextName()
+	if err != nil {
+		return "", err
+	}
+	if contextName == "" || contextName == "default" {
+		return defaultDockerHost, nil
+	}
+
+	// context metadata is stored in a directory named after the sha256 of the context name,
+	// see https://docs.docker.com/engine/manage-resources/contexts/
+	digest := sha256.Sum256([]byte(contextName))
+	metaFile := filepath.Join(dockerConfigDir(), "contexts", "meta", hex.EncodeToString(digest[:]), "meta.json")
+	metaBytes, err := os.ReadFile(metaFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read metadata of docker context %s: %w", contextName, err)
+	}
+
+	var meta struct {
+		Endpoints map[string]struct {
+			Host string
+		}
+	}
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		return "", fmt.Errorf("could not parse metadata of docker context %s - nested error: %w", contextName, err)
+	}
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return "", fmt.Errorf("docker context %s has no docker endpoint", contextName)
+	}
+	return endpoint.Host, nil
+}
+
+func currentDockerContextName() (string, error) {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name, nil
+	}
+
+	configBytes, err := os.ReadFile(filepath.Join(dockerConfigDir(), "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read docker config: %w", err)
+	}
+
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return "", fmt.Errorf("could not parse docker config - nested error: %w", err)
+	}
+	return config.CurrentContext, nil
+}
+
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker")
+}
+
+func dockerTlsConfigFromEnv() (*tls.Config, error) {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		certPath = dockerConfigDir()
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load docker TLS client certificate from %s: %w", certPath, err)
+	}
+	caBytes, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load docker TLS CA from %s: %w", certPath, err)
+	}
+	caPool := x509.NewCertPool()
+	caPool.AppendCertsFromPEM(caBytes)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+	}, nil
+}
+
+// DockerApiError is a non-2xx response of the docker daemon.
+type DockerApiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerApiError) Error() string {
+	return e.Message
+}
+
+func (c *DockerClient) get(path string, query url.Values, result any) error {
+	resp, err := c.do(http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("could not parse response of docker daemon for %s - nested error: %w", path, err)
+	}
+	return nil
+}
+
+// do runs the request and converts non-2xx responses into errors containing the daemon's message.
+func (c *DockerClient) do(method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := c.baseUrl + "/" + dockerApiVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// the URL is made up anyways for unix sockets; so we only report the underlying error (e.g. permission denied)
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("could not connect to the container daemon at %s: %w", c.Host, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	var errorBody struct {
+		Message string `json:"message"`
+	}
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(bodyBytes, &errorBody) != nil || errorBody.Message == "" {
+		errorBody.Message = strings.TrimSpace(string(bodyBytes))
+	}
+	apiErr := &DockerApiError{StatusCode: resp.StatusCode, Message: errorBody.Message}
+	if resp.StatusCode == http.StatusNotFound && strings.Contains(strings.ToLower(apiErr.Message), "no such container") {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchContainer, apiErr.Message)
+	}
+	return nil, fmt.Errorf("docker daemon returned %s for %s: %w", resp.Status, path, apiErr)
+}
+
+// PathExists checks whether the given path exists inside the container's file system. This works without
+// starting a helper container, because it uses the archive API (like "docker cp").
+func (c *DockerClient) PathExists(containerName, path string) (bool, error) {
+	resp, err := c.do(http.MethodHead, "/containers/"+url.PathEscape(containerName)+"/archive", url.Values{"path": {path}}, nil)
+	var apiErr *DockerApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		// a HEAD response has no body with the message; so an unknown container looks like a missing path.
+		if _, err := c.InspectContainer(containerName); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// ContainerInfo is the subset of "docker container inspect" drydock needs.
+type ContainerInfo struct {
+	ID string
+	// Name of the container, without the leading slash the API returns.
+	Name    string
+	Image   string
+	Running bool
+	// Pid of the container's init process, as seen from the (possibly virtualized) docker host. 0 if not running.
+	Pid       int
+	StartedAt time.Time
+	Env       []string
+	Labels    map[string]string
+	Ports     []PortBinding
+}
+
+type PortBinding struct {
+	// ContainerPort in the docker notation, e.g. "80/tcp"
+	ContainerPort string
+	HostIp        string
+	HostPort      int
+}
+
+type containerInspectResponse struct {
+	Id    string
+	Name  string
+	State struct {
+		Running   bool
+		Pid       int
+		StartedAt time.Time
+	}
+	Config struct {
+		Image  string
+		Env    []string
+		Labels map[string]string
+	}
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIp   string
+			HostPort string
+		}
+	}
+}
+
+// InspectContainer returns the metadata of the given container (name or ID).
+func (c *DockerClient) InspectContainer(containerName string) (*ContainerInfo, error) {
+	var raw containerInspectResponse
+	if err := c.get("/containers/"+url.PathEscape(containerName)+"/json", nil, &raw); err != nil {
+		return nil, err
+	}
+
+	info := &ContainerInfo{
+		ID:        raw.Id,
+		Name:      strings.TrimPrefix(raw.Name, "/"),
+		Image:     raw.Config.Image,
+		Running:   raw.State.Running,
+		Pid:       raw.State.Pid,
+		StartedAt: raw.State.StartedAt,
+		Env:       raw.Config.Env,
+		Labels:    raw.Config.Labels,
+	}
+	for containerPort, bindings := range raw.NetworkSettings.Ports {
+		for _, binding := range bindings {
+			hostPort, err := strconv.Atoi(binding.HostPort)
+			if err != nil {
+				continue
+			}
+			info.Ports = append(info.Ports, PortBinding{
+				ContainerPort: containerPort,
+				HostIp:        binding.HostIp,
+				HostPort:      hostPort,
+			})
+		}
+	}
+	return info, nil
+}
+
+// sshCommandConn is a net.Conn speaking to the stdin/stdout of an ssh process running dial-stdio of the runtime.
+type sshCommandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func dialSshDocker(u *url.URL, dialStdio []string) (net.Conn, error) {
+	remote := ParseRemoteDockerHost(u.String())
+	destination := remote.SshDestination()
+	args := append(remote.SshArgs(), dialStdio...)
+
+	cmd := exec.Command("ssh", args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start ssh to %s: %w", destination, err)
+	}
+	return &sshCommandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (s *sshCommandConn) Read(p []byte) (int, error)  { return s.stdout.Read(p) }
+func (s *sshCommandConn) Write(p []byte) (int, error) { return s.stdin.Write(p) }
+func (s *sshCommandConn) Close() error {
+	s.stdin.Close()
+	s.stdout.Close()
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.cmd.Wait()
+	return nil
+}
+func (s *sshCommandConn) LocalAddr() net.Addr                { return sshAddr{} }
+func (s *sshCommandConn) RemoteAddr() net.Addr               { return sshAddr{} }
+func (s *sshCommandConn) SetDeadline(_ time.Time) error      { return nil }
+func (s *sshCommandConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (s *sshCommandConn) SetWriteDeadline(_ time.Time) error { return nil }
+
+type sshAddr struct{}
+
+func (sshAddr) Network() string { return "ssh" }
+func (sshAddr) String() string  { return "ssh" }
+
+// ContainerSummary is one entry of "docker container ls".
+type ContainerSummary struct {
+	ID string
+	// Name of the container, without leading slash.
+	Name    string
+	Image   string
+	Labels  map[string]string
+	State   string
+	Status  string
+	Created time.Time
+}
+
+type containerListResponse struct {
+	Id      string
+	Names   []string
+	Image   string
+	Labels  map[string]string
+	State   string
+	Status  string
+	Created int64
+}
+
+// ListContainers returns the running containers (or all containers, if all is true), filtered by the given
+// docker filters (e.g. {"label": ["com.docker.compose.service=web"]}).
+func (c *DockerClient) ListContainers(all bool, filters map[string][]string) ([]ContainerSummary, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	if len(filters) > 0 {
+		filterJson, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(filterJson))
+	}
+
+	var raw []containerListResponse
+	if err := c.get("/containers/json", query, &raw); err != nil {
+		return nil, err
+	}
+
+	result := make([]ContainerSummary, 0, len(raw))
+	for _, container := range raw {
+		name := ""
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		result = append(result, ContainerSummary{
+			ID:      container.Id,
+			Name:    name,
+			Image:   container.Image,
+			Labels:  container.Labels,
+			State:   container.State,
+			Status:  container.Status,
+			Created: time.Unix(container.Created, 0),
+		})
+	}
+	return result, nil
+}
+
+// ReadFile reads a single file from the container's file system via the archive API (like "docker cp"). If the
+// file does not exist, an error wrapping os.ErrNotExist is returned.
+func (c *DockerClient) ReadFile(containerName, path string) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, "/containers/"+url.PathEscape(containerName)+"/archive", url.Values{"path": {path}}, nil)
+	var apiErr *DockerApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s in container %s: %w", path, containerName, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tarReader := tar.NewReader(resp.Body)
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, fmt.Errorf("could not read archive of %s: %w", path, err)
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("%s in container %s is not a regular file", path, containerName)
+	}
+	return io.ReadAll(tarReader)
+}
+
+// RemoveContainer removes the given container; if force is true, it is killed first if it is running.
+func (c *DockerClient) RemoveContainer(containerName string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	resp, err := c.do(http.MethodDelete, "/containers/"+url.PathEscape(containerName), query, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ImageExists checks whether the given image is present locally.
+func (c *DockerClient) ImageExists(image string) (bool, error) {
+	resp, err := c.do(http.MethodGet, "/images/"+image+"/json", nil, nil)
+	var apiErr *DockerApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
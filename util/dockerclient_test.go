@@ -0,0 +1,236 @@
+package util
+
+import (
+	"archive/tar"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeDockerDaemon serves handler on a unix socket, like the docker daemon does; it returns a client for it.
+func fakeDockerDaemon(t *testing.T, handler http.Handler) *DockerClient {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	client, err := NewDockerClient("unix://" + socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// fakeDockerResponse writes the given status and body for all requests.
+func fakeDockerResponse(status int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+}
+
+func TestDockerClientInspectContainer(t *testing.T) {
+	var requestedPath string
+	client := fakeDockerDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		w.Write([]byte(`{
+			"Id": "4f66ad9a0b2e",
+			"Name": "/myproject-neos-1",
+			"State": {"Running": true, "Pid": 2754, "StartedAt": "2024-01-15T10:00:00Z"},
+			"Config": {
+				"Image": "myproject/neos:latest",
+				"Env": ["PHP_INI_DIR=/usr/local/etc/php"],
+				"Labels": {"com.docker.compose.service": "neos"}
+			},
+			"NetworkSettings": {"Ports": {
+				"80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "8080"}],
+				"9000/tcp": null
+			}}
+		}`))
+	}))
+
+	info, err := client.InspectContainer("myproject-neos-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if requestedPath != "/"+dockerApiVersion+"/containers/myproject-neos-1/json" {
+		t.Errorf("requested %s", requestedPath)
+	}
+	want := &ContainerInfo{
+		ID:        "4f66ad9a0b2e",
+		Name:      "myproject-neos-1",
+		Image:     "myproject/neos:latest",
+		Running:   true,
+		Pid:       2754,
+		StartedAt: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		Env:       []string{"PHP_INI_DIR=/usr/local/etc/php"},
+		Labels:    map[string]string{"com.docker.compose.service": "neos"},
+		Ports:     []PortBinding{{ContainerPort: "80/tcp", HostIp: "0.0.0.0", HostPort: 8080}},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+}
+
+func TestDockerClientErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		wantNoSuch     bool
+		wantStatusCode int
+		wantMessage    string
+	}{
+		{
+			name:       "unknown container",
+			status:     http.StatusNotFound,
+			body:       `{"message": "No such container: foo"}`,
+			wantNoSuch: true,
+		},
+		{
+			name:           "other not found",
+			status:         http.StatusNotFound,
+			body:           `{"message": "page not found"}`,
+			wantStatusCode: http.StatusNotFound,
+			wantMessage:    "page not found",
+		},
+		{
+			name:           "daemon error",
+			status:         http.StatusInternalServerError,
+			body:           `{"message": "container is restarting"}`,
+			wantStatusCode: http.StatusInternalServerError,
+			wantMessage:    "container is restarting",
+		},
+		{
+			name:           "error without JSON body",
+			status:         http.StatusBadGateway,
+			body:           "upstream unavailable\n",
+			wantStatusCode: http.StatusBadGateway,
+			wantMessage:    "upstream unavailable",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fakeDockerDaemon(t, fakeDockerResponse(test.status, test.body))
+			_, err := client.InspectContainer("foo")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if errors.Is(err, ErrNoSuchContainer) != test.wantNoSuch {
+				t.Errorf("errors.Is(%v, ErrNoSuchContainer) = %v, want %v", err, !test.wantNoSuch, test.wantNoSuch)
+			}
+			if test.wantNoSuch {
+				return
+			}
+			var apiErr *DockerApiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected a DockerApiError, got %v", err)
+			}
+			if apiErr.StatusCode != test.wantStatusCode || apiErr.Message != test.wantMessage {
+				t.Errorf("got %d %q, want %d %q", apiErr.StatusCode, apiErr.Message, test.wantStatusCode, test.wantMessage)
+			}
+		})
+	}
+}
+
+func TestDockerClientArchive(t *testing.T) {
+	// the archive API answers 404 with this message for paths which do not exist in the container.
+	const pathNotFound = `{"message": "Could not find the file /var/lib/drydock/journal.jsonl in container foo"}`
+
+	tests := []struct {
+		name string
+		// handler serves the archive API of container foo; unknownContainer answers all requests with 404 instead.
+		handler          http.Handler
+		unknownContainer bool
+		wantExists       bool
+		wantContent      string
+		wantNotExist     bool
+		wantErrExists    bool
+		wantErrReadFile  bool
+	}{
+		{
+			name: "existing file",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					return
+				}
+				tarWriter := tar.NewWriter(w)
+				tarWriter.WriteHeader(&tar.Header{Name: "journal.jsonl", Mode: 0644, Size: 3, Typeflag: tar.TypeReg})
+				tarWriter.Write([]byte("{}\n"))
+				tarWriter.Close()
+			}),
+			wantExists:  true,
+			wantContent: "{}\n",
+		},
+		{
+			name:         "missing file",
+			handler:      fakeDockerResponse(http.StatusNotFound, pathNotFound),
+			wantNotExist: true,
+		},
+		{
+			name:             "unknown container",
+			unknownContainer: true,
+			wantErrExists:    true,
+			wantErrReadFile:  true,
+		},
+		{
+			name: "directory",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tarWriter := tar.NewWriter(w)
+				tarWriter.WriteHeader(&tar.Header{Name: "drydock/", Mode: 0755, Typeflag: tar.TypeDir})
+				tarWriter.Close()
+			}),
+			wantExists:      true,
+			wantErrReadFile: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			daemon := http.NewServeMux()
+			if test.unknownContainer {
+				daemon.Handle("/", fakeDockerResponse(http.StatusNotFound, `{"message": "No such container: foo"}`))
+			} else {
+				daemon.Handle("/"+dockerApiVersion+"/containers/foo/archive", test.handler)
+				daemon.Handle("/"+dockerApiVersion+"/containers/foo/json", fakeDockerResponse(http.StatusOK, `{"Id": "4f66ad9a0b2e", "Name": "/foo"}`))
+			}
+			client := fakeDockerDaemon(t, daemon)
+
+			exists, err := client.PathExists("foo", JournalPath)
+			if (err != nil) != test.wantErrExists {
+				t.Fatalf("PathExists: unexpected error %v", err)
+			}
+			if exists != test.wantExists {
+				t.Errorf("PathExists = %v, want %v", exists, test.wantExists)
+			}
+
+			content, err := client.ReadFile("foo", JournalPath)
+			if errors.Is(err, os.ErrNotExist) != test.wantNotExist {
+				t.Errorf("ReadFile: errors.Is(%v, os.ErrNotExist) = %v, want %v", err, !test.wantNotExist, test.wantNotExist)
+			}
+			if test.wantNotExist {
+				return
+			}
+			if (err != nil) != test.wantErrReadFile {
+				t.Fatalf("ReadFile: unexpected error %v", err)
+			}
+			if string(content) != test.wantContent {
+				t.Errorf("ReadFile = %q, want %q", content, test.wantContent)
+			}
+		})
+	}
+}
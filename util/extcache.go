@@ -0,0 +1,156 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PhpBuildKey identifies the PHP builds a compiled extension is binary compatible with.
+type PhpBuildKey struct {
+	// PhpVersion is major.minor, e.g. 8.2
+	PhpVersion string
+	// PhpApi is the "PHP API" build number, e.g. 20220829
+	PhpApi string
+	Zts    bool
+	// Arch is the machine architecture (uname -m), e.g. x86_64 or aarch64
+	Arch string
+	// Libc is glibc or musl (Alpine)
+	Libc string
+}
+
+// String is the directory name of the key in the cache, e.g. php8.2-api20220829-nts-x86_64-glibc
+func (k PhpBuildKey) String() string {
+	threadSafety := "nts"
+	if k.Zts {
+		threadSafety = "zts"
+	}
+	return fmt.Sprintf("php%s-api%s-%s-%s-%s", k.PhpVersion, k.PhpApi, threadSafety, k.Arch, k.Libc)
+}
+
+// ExtensionCache stores compiled PHP extensions (.so files) on this machine, so that they are only built once per
+// PHP build: <Dir>/<extension>/<version>/<build key>/<extension>.so
+type ExtensionCache struct {
+	Dir string
+}
+
+// CachedExtension is an entry of the ExtensionCache.
+type CachedExtension struct {
+	Extension string
+	Version   string
+	BuildKey  string
+	Path      string
+	Size      int64
+	ModTime   time.Time
+}
+
+// DefaultExtensionCache is located in the user cache dir, e.g. ~/.cache/drydock/extensions on Linux.
+func DefaultExtensionCache() (*ExtensionCache, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not find the cache directory: %w", err)
+	}
+	return &ExtensionCache{Dir: filepath.Join(cacheDir, "drydock", "extensions")}, nil
+}
+
+// Path is where the .so file for the given extension, version and build is stored.
+func (c *ExtensionCache) Path(extension, version string, key PhpBuildKey) string {
+	return filepath.Join(c.Dir, extension, NormalizePhpExtensionVersion(version), key.String(), extension+".so")
+}
+
+// Lookup returns the path of the cached .so file, if it exists.
+func (c *ExtensionCache) Lookup(extension, version string, key PhpBuildKey) (string, bool) {
+	path := c.Path(extension, version, key)
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return "", false
+	}
+	return path, true
+}
+
+// Store writes the .so file into the cache: write gets a temporary file, and the entry is only committed (renamed) if
+// write succeeded and wrote a non-empty file; so that an aborted transfer never leaves a broken cache entry.
+func (c *ExtensionCache) Store(extension, version string, key PhpBuildKey, write func(w io.Writer) error) error {
+	path := c.Path(extension, version, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), extension+".so.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	if info, err := os.Stat(file.Name()); err != nil || info.Size() == 0 {
+		return fmt.Errorf("%s.so is empty", extension)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// List returns all cached extensions, sorted by extension, version and build key.
+func (c *ExtensionCache) List() ([]CachedExtension, error) {
+	var entries []CachedExtension
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".so") {
+			return nil
+		}
+		relative, _ := filepath.Rel(c.Dir, path)
+		parts := strings.Split(relative, string(filepath.Separator))
+		if len(parts) != 4 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, CachedExtension{
+			Extension: parts[0],
+			Version:   parts[1],
+			BuildKey:  parts[2],
+			Path:      path,
+			Size:      info.Size(),
+			ModTime:   info.ModTime(),
+		})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Extension != b.Extension {
+			return a.Extension < b.Extension
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.BuildKey < b.BuildKey
+	})
+	return entries, err
+}
+
+// Clear removes the cached builds of the given extension, or the whole cache if extension is empty.
+func (c *ExtensionCache) Clear(extension string) error {
+	if extension == "" {
+		return os.RemoveAll(c.Dir)
+	}
+	if extension != filepath.Base(extension) || extension == ".." {
+		return fmt.Errorf("invalid extension name %s", extension)
+	}
+	return os.RemoveAll(filepath.Join(c.Dir, extension))
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestExtensionCacheStore(t *testing.T) {
+	key := PhpBuildKey{PhpVersion: "8.2", PhpApi: "20220829", Arch: "x86_64", Libc: "glibc"}
+
+	tests := []struct {
+		name      string
+		write     func(w io.Writer) error
+		wantEntry bool
+	}{
+		{
+			name: "complete transfer",
+			write: func(w io.Writer) error {
+				_, err := io.WriteString(w, "\x7fELF...")
+				return err
+			},
+			wantEntry: true,
+		},
+		{
+			name: "transfer failing partway",
+			write: func(w io.Writer) error {
+				io.WriteString(w, "\x7fEL")
+				return errors.New("exit status 1")
+			},
+		},
+		{
+			name: "empty file",
+			write: func(w io.Writer) error {
+				return nil
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := &ExtensionCache{Dir: t.TempDir()}
+			err := cache.Store("xdebug", "3.3.2", key, test.write)
+			if test.wantEntry && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !test.wantEntry && err == nil {
+				t.Fatalf("expected an error")
+			}
+
+			_, found := cache.Lookup("xdebug", "3.3.2", key)
+			if found != test.wantEntry {
+				t.Errorf("cache entry exists = %v, want %v", found, test.wantEntry)
+			}
+			entries, _ := os.ReadDir(cache.Dir + "/xdebug/3.3.2/" + key.String())
+			if !test.wantEntry && len(entries) > 0 {
+				t.Errorf("temporary files are left behind: %v", entries)
+			}
+		})
+	}
+}
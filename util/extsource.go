@@ -0,0 +1,107 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PhpExtensionSource are local sources of a PHP extension (--source), to build it without network access.
+type PhpExtensionSource struct {
+	// Path is a tarball (.tgz, .tar.gz or .tar), or a directory with the extracted sources.
+	Path string
+	// Version is taken from the file name, e.g. 3.3.2 for xdebug-3.3.2.tgz; empty if the name contains none.
+	Version string
+}
+
+// IsDir is true if the sources are a directory, which needs to be packed for the transfer.
+func (s PhpExtensionSource) IsDir() bool {
+	info, err := os.Stat(s.Path)
+	return err == nil && info.IsDir()
+}
+
+// Gzipped is true for .tgz and .tar.gz tarballs.
+func (s PhpExtensionSource) Gzipped() bool {
+	return strings.HasSuffix(s.Path, ".tgz") || strings.HasSuffix(s.Path, ".gz")
+}
+
+var phpExtensionTarballSuffixes = []string{".tgz", ".tar.gz", ".tar"}
+
+// ResolvePhpExtensionSource finds the sources of the extension given by source:
+//   - a tarball, e.g. xdebug-3.3.2.tgz from "pecl download xdebug-3.3.2", or a GitHub archive like php-spx-0.4.15.tar.gz
+//   - a directory with the extracted sources (containing config.m4)
+//   - a directory with pre-fetched tarballs; the one for version is used, or the only one of the extension
+func ResolvePhpExtensionSource(source string, extension string, version string) (*PhpExtensionSource, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the %s sources: %w", extension, err)
+	}
+	if !info.IsDir() {
+		if !isPhpExtensionTarball(source) {
+			return nil, fmt.Errorf("%s is no tarball - expected a .tgz, .tar.gz or .tar file, or a directory", source)
+		}
+		return &PhpExtensionSource{Path: source, Version: phpExtensionSourceVersion(source, extension)}, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(source, "config.m4")); err == nil {
+		return &PhpExtensionSource{Path: source, Version: phpExtensionSourceVersion(source, extension)}, nil
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return nil, err
+	}
+	var tarballs []*PhpExtensionSource
+	for _, entry := range entries {
+		path := filepath.Join(source, entry.Name())
+		if entry.IsDir() || !isPhpExtensionTarball(path) {
+			continue
+		}
+		tarballVersion := phpExtensionSourceVersion(path, extension)
+		if tarballVersion == "" {
+			continue
+		}
+		if NormalizePhpExtensionVersion(tarballVersion) == NormalizePhpExtensionVersion(version) {
+			return &PhpExtensionSource{Path: path, Version: tarballVersion}, nil
+		}
+		tarballs = append(tarballs, &PhpExtensionSource{Path: path, Version: tarballVersion})
+	}
+
+	switch len(tarballs) {
+	case 0:
+		return nil, fmt.Errorf("%s contains neither config.m4 nor a tarball of %s (e.g. %s-<version>.tgz)", source, extension, extension)
+	case 1:
+		return tarballs[0], nil
+	}
+	var versions []string
+	for _, tarball := range tarballs {
+		versions = append(versions, tarball.Version)
+	}
+	return nil, fmt.Errorf("%s contains several %s tarballs (%s) - select one with --version", source, extension, strings.Join(versions, ", "))
+}
+
+func isPhpExtensionTarball(path string) bool {
+	for _, suffix := range phpExtensionTarballSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// phpExtensionSourceVersion extracts the version from names like xdebug-3.3.2.tgz, php-spx-0.4.15.tar.gz or
+// excimer-1.2.2 (an extracted directory).
+func phpExtensionSourceVersion(path string, extension string) string {
+	name := filepath.Base(path)
+	for _, suffix := range phpExtensionTarballSuffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	pattern := regexp.MustCompile(`^(php-)?` + regexp.QuoteMeta(extension) + `-(v?[0-9][A-Za-z0-9._-]*)$`)
+	match := pattern.FindStringSubmatch(name)
+	if match == nil {
+		return ""
+	}
+	return match[2]
+}
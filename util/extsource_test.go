@@ -0,0 +1,147 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPhpExtensionSourceVersion(t *testing.T) {
+	tests := []struct {
+		path      string
+		extension string
+		want      string
+	}{
+		{path: "/downloads/xdebug-3.3.2.tgz", extension: "xdebug", want: "3.3.2"},
+		{path: "xdebug-3.4.0beta1.tar.gz", extension: "xdebug", want: "3.4.0beta1"},
+		{path: "php-spx-0.4.15.tar.gz", extension: "spx", want: "0.4.15"},
+		{path: "excimer-1.2.2", extension: "excimer", want: "1.2.2"},
+		{path: "excimer-v1.2.2.tar", extension: "excimer", want: "v1.2.2"},
+		{path: "xdebug", extension: "xdebug", want: ""},
+		{path: "xdebug-master.tgz", extension: "xdebug", want: ""},
+		{path: "pcov-1.0.11.tgz", extension: "xdebug", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := phpExtensionSourceVersion(test.path, test.extension); got != test.want {
+				t.Errorf("phpExtensionSourceVersion(%s, %s) = %q, want %q", test.path, test.extension, got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolvePhpExtensionSource(t *testing.T) {
+	tests := []struct {
+		name string
+		// files are created in a temporary directory
+		files       []string
+		source      string
+		version     string
+		wantPath    string
+		wantVersion string
+		wantErr     string
+	}{
+		{
+			name:        "pecl tarball",
+			files:       []string{"xdebug-3.3.2.tgz"},
+			source:      "xdebug-3.3.2.tgz",
+			version:     "3.3.2",
+			wantPath:    "xdebug-3.3.2.tgz",
+			wantVersion: "3.3.2",
+		},
+		{
+			name:        "GitHub archive",
+			files:       []string{"php-xdebug-3.3.1.tar.gz"},
+			source:      "php-xdebug-3.3.1.tar.gz",
+			version:     "3.3.2",
+			wantPath:    "php-xdebug-3.3.1.tar.gz",
+			wantVersion: "3.3.1",
+		},
+		{
+			name:    "no tarball",
+			files:   []string{"xdebug-3.3.2.zip"},
+			source:  "xdebug-3.3.2.zip",
+			wantErr: "is no tarball",
+		},
+		{
+			name:    "missing",
+			source:  "xdebug-3.3.2.tgz",
+			wantErr: "could not read the xdebug sources",
+		},
+		{
+			name:     "extracted sources without a version",
+			files:    []string{"xdebug/config.m4"},
+			source:   "xdebug",
+			version:  "3.3.2",
+			wantPath: "xdebug",
+		},
+		{
+			name:        "extracted sources with a version",
+			files:       []string{"xdebug-3.3.2/config.m4"},
+			source:      "xdebug-3.3.2",
+			wantPath:    "xdebug-3.3.2",
+			wantVersion: "3.3.2",
+		},
+		{
+			name:        "tarball of the version from a directory",
+			files:       []string{"tarballs/xdebug-3.1.6.tgz", "tarballs/xdebug-3.3.2.tgz", "tarballs/pcov-1.0.11.tgz"},
+			source:      "tarballs",
+			version:     "v3.3.2",
+			wantPath:    "tarballs/xdebug-3.3.2.tgz",
+			wantVersion: "3.3.2",
+		},
+		{
+			name:        "only tarball of the extension in a directory",
+			files:       []string{"tarballs/xdebug-3.1.6.tgz", "tarballs/pcov-1.0.11.tgz", "tarballs/README"},
+			source:      "tarballs",
+			version:     "3.3.2",
+			wantPath:    "tarballs/xdebug-3.1.6.tgz",
+			wantVersion: "3.1.6",
+		},
+		{
+			name:    "several tarballs, none of the version",
+			files:   []string{"tarballs/xdebug-3.1.6.tgz", "tarballs/xdebug-3.2.2.tgz"},
+			source:  "tarballs",
+			version: "3.3.2",
+			wantErr: "contains several xdebug tarballs (3.1.6, 3.2.2)",
+		},
+		{
+			name:    "directory without sources",
+			files:   []string{"tarballs/pcov-1.0.11.tgz"},
+			source:  "tarballs",
+			version: "3.3.2",
+			wantErr: "contains neither config.m4 nor a tarball of xdebug",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range test.files {
+				path := filepath.Join(dir, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("sources"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := ResolvePhpExtensionSource(filepath.Join(dir, test.source), "xdebug", test.version)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got.Path != filepath.Join(dir, test.wantPath) || got.Version != test.wantVersion {
+				t.Errorf("got %s (version %q), want %s (version %q)", got.Path, got.Version, test.wantPath, test.wantVersion)
+			}
+		})
+	}
+}
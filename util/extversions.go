@@ -0,0 +1,52 @@
+package util
+
+import (
+	_ "embed"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"regexp"
+)
+
+// PhpExtensionVersionLatest installs the newest release of an extension; used for PHP versions which are not in the
+// compatibility matrix.
+const PhpExtensionVersionLatest = "latest"
+
+//go:embed extversions.yaml
+var phpExtensionVersionsYaml []byte
+
+// PhpExtensionVersions is the compatibility matrix: extension -> PHP minor version (e.g. 8.2) -> known-good version
+type PhpExtensionVersions map[string]map[string]string
+
+// DefaultPhpExtensionVersions is the compatibility matrix embedded into drydock (extversions.yaml).
+func DefaultPhpExtensionVersions() PhpExtensionVersions {
+	var versions PhpExtensionVersions
+	if err := yaml.Unmarshal(phpExtensionVersionsYaml, &versions); err != nil {
+		panic(fmt.Sprintf("invalid extversions.yaml: %s", err))
+	}
+	return versions
+}
+
+// For returns the known-good version of the extension for the given PHP minor version; false if it is not listed.
+func (v PhpExtensionVersions) For(extension, phpMinorVersion string) (string, bool) {
+	version, ok := v[extension][phpMinorVersion]
+	return version, ok
+}
+
+// NormalizePhpExtensionVersion drops the "v" of git tags like v0.4.15, so that the same version from a tag and from a
+// tarball (php-spx-0.4.15.tar.gz) is the same cache entry.
+func NormalizePhpExtensionVersion(version string) string {
+	if len(version) > 1 && version[0] == 'v' && version[1] >= '0' && version[1] <= '9' {
+		return version[1:]
+	}
+	return version
+}
+
+var phpExtensionVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidatePhpExtensionVersion checks a version given by the user; it ends up in shell scripts and cache paths.
+func ValidatePhpExtensionVersion(version string) error {
+	if !phpExtensionVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid extension version %q - e.g. 3.3.2 or %s", version, PhpExtensionVersionLatest)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultPhpExtensionVersions(t *testing.T) {
+	versions := DefaultPhpExtensionVersions()
+	for _, extension := range []string{"xdebug", "spx", "excimer"} {
+		if len(versions[extension]) == 0 {
+			t.Errorf("extversions.yaml lists no versions of %s", extension)
+		}
+		for phpVersion, version := range versions[extension] {
+			if err := ValidatePhpExtensionVersion(version); err != nil {
+				t.Errorf("%s for PHP %s: %s", extension, phpVersion, err)
+			}
+		}
+	}
+
+	tests := []struct {
+		extension  string
+		phpVersion string
+		want       string
+		wantOk     bool
+	}{
+		{extension: "xdebug", phpVersion: "7.4", want: "3.1.6", wantOk: true},
+		{extension: "xdebug", phpVersion: "8.4", want: "3.4.1", wantOk: true},
+		{extension: "spx", phpVersion: "8.2", want: "v0.4.15", wantOk: true},
+		{extension: "xdebug", phpVersion: "5.6", wantOk: false},
+		{extension: "xdebug", phpVersion: "9.0", wantOk: false},
+		{extension: "unknown", phpVersion: "8.2", wantOk: false},
+	}
+	for _, test := range tests {
+		got, ok := versions.For(test.extension, test.phpVersion)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("For(%s, %s) = %q, %v - want %q, %v", test.extension, test.phpVersion, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestNormalizePhpExtensionVersion(t *testing.T) {
+	tests := map[string]string{
+		"v0.4.15": "0.4.15",
+		"0.4.15":  "0.4.15",
+		"3.4.0":   "3.4.0",
+		"v":       "v",
+		"vnext":   "vnext",
+		"latest":  "latest",
+		"":        "",
+	}
+	for version, want := range tests {
+		if got := NormalizePhpExtensionVersion(version); got != want {
+			t.Errorf("NormalizePhpExtensionVersion(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestValidatePhpExtensionVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		wantErr bool
+	}{
+		{version: "3.3.2"},
+		{version: "v0.4.15"},
+		{version: "3.4.0beta1"},
+		{version: "1.2.2-rc_1"},
+		{version: PhpExtensionVersionLatest},
+		{version: "", wantErr: true},
+		{version: "-3.3.2", wantErr: true},
+		{version: "../3.3.2", wantErr: true},
+		{version: "3.3.2/..", wantErr: true},
+		{version: "3.3.2; rm -Rf /", wantErr: true},
+		{version: "$(id)", wantErr: true},
+	}
+	for _, test := range tests {
+		err := ValidatePhpExtensionVersion(test.version)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidatePhpExtensionVersion(%q) = %v, want error: %v", test.version, err, test.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "invalid extension version") {
+			t.Errorf("unexpected error message: %s", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// JournalPath is the file inside a target container where drydock records every change it makes.
+const JournalPath = "/var/lib/drydock/journal.jsonl"
+
+const (
+	JournalActionInstall = "install"
+	JournalActionRemove  = "remove"
+)
+
+// JournalEntry is one line of the journal: a single change drydock made to the container.
+type JournalEntry struct {
+	Tool    string `json:"tool"`
+	Action  string `json:"action"`
+	Version string `json:"version,omitempty"`
+	// Files are the paths (inside the container) which were written or removed.
+	Files          []string  `json:"files"`
+	Timestamp      time.Time `json:"timestamp"`
+	DrydockVersion string    `json:"drydockVersion"`
+	// Host is the machine drydock ran on.
+	Host string `json:"host,omitempty"`
+}
+
+// ParseJournal parses the JSON lines journal; lines which cannot be parsed are skipped.
+func ParseJournal(data []byte) []JournalEntry {
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry JournalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ReadJournal reads the journal of the given container. A container without journal has no entries.
+func ReadJournal(runtime Runtime, containerName string) ([]JournalEntry, error) {
+	data, err := runtime.ReadFile(containerName, JournalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read drydock journal: %w", err)
+	}
+	return ParseJournal(data), nil
+}
+
+// ActiveJournalFiles returns the files which were installed according to the journal, and not removed afterwards;
+// in the order they were installed.
+func ActiveJournalFiles(entries []JournalEntry) []string {
+	active := map[string]bool{}
+	var order []string
+	for _, entry := range entries {
+		for _, file := range entry.Files {
+			switch entry.Action {
+			case JournalActionInstall:
+				if !active[file] {
+					order = append(order, file)
+				}
+				active[file] = true
+			case JournalActionRemove:
+				active[file] = false
+			}
+		}
+	}
+
+	var result []string
+	for _, file := range order {
+		if active[file] {
+			result = append(result, file)
+			// files installed again later must only be listed once
+			active[file] = false
+		}
+	}
+	return result
+}
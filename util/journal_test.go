@@ -0,0 +1,112 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseJournal(t *testing.T) {
+	journal := `{"tool":"xdebug","action":"install","version":"3.3.2","files":["/usr/local/etc/php/conf.d/drydock-xdebug.ini"],"timestamp":"2024-01-15T10:00:00Z","drydockVersion":"1.2.0"}
+{"tool":"xdebug","action":"remove","files":["/usr/local/etc/php/conf.d/drydock-xdebug.i
+
+{"tool":"spx","action":"install","version":"v0.4.15","files":["/usr/local/etc/php/conf.d/drydock-spx.ini"],"timestamp":"2024-01-15T11:00:00Z","drydockVersion":"1.2.0","host":"laptop"}
+`
+	want := []JournalEntry{
+		{
+			Tool:           "xdebug",
+			Action:         JournalActionInstall,
+			Version:        "3.3.2",
+			Files:          []string{"/usr/local/etc/php/conf.d/drydock-xdebug.ini"},
+			Timestamp:      time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+			DrydockVersion: "1.2.0",
+		},
+		{
+			Tool:           "spx",
+			Action:         JournalActionInstall,
+			Version:        "v0.4.15",
+			Files:          []string{"/usr/local/etc/php/conf.d/drydock-spx.ini"},
+			Timestamp:      time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+			DrydockVersion: "1.2.0",
+			Host:           "laptop",
+		},
+	}
+
+	// the truncated line (e.g. from a full disk) and the empty line are skipped
+	if got := ParseJournal([]byte(journal)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadJournal(t *testing.T) {
+	runtime := newFakeRuntime()
+	entries, err := ReadJournal(runtime, "foo")
+	if err != nil || entries != nil {
+		t.Errorf("container without journal: got %v, %v - want no entries", entries, err)
+	}
+
+	runtime.files = map[string]string{JournalPath: `{"tool":"xdebug","action":"install","files":["/tmp/drydock-xdebug"]}` + "\n"}
+	entries, err = ReadJournal(runtime, "foo")
+	if err != nil || len(entries) != 1 || entries[0].Tool != "xdebug" {
+		t.Errorf("got %+v, %v - want the xdebug entry", entries, err)
+	}
+}
+
+func TestActiveJournalFiles(t *testing.T) {
+	install := func(files ...string) JournalEntry {
+		return JournalEntry{Action: JournalActionInstall, Files: files}
+	}
+	remove := func(files ...string) JournalEntry {
+		return JournalEntry{Action: JournalActionRemove, Files: files}
+	}
+
+	tests := []struct {
+		name    string
+		entries []JournalEntry
+		want    []string
+	}{
+		{
+			name:    "empty journal",
+			entries: nil,
+			want:    nil,
+		},
+		{
+			name:    "installed",
+			entries: []JournalEntry{install("/a.ini", "/b.so")},
+			want:    []string{"/a.ini", "/b.so"},
+		},
+		{
+			name:    "installed and removed",
+			entries: []JournalEntry{install("/a.ini", "/b.so"), remove("/a.ini")},
+			want:    []string{"/b.so"},
+		},
+		{
+			name:    "installed again",
+			entries: []JournalEntry{install("/a.ini"), install("/a.ini", "/b.so")},
+			want:    []string{"/a.ini", "/b.so"},
+		},
+		{
+			name:    "installed again after removal",
+			entries: []JournalEntry{install("/a.ini"), remove("/a.ini"), install("/b.so"), install("/a.ini")},
+			want:    []string{"/a.ini", "/b.so"},
+		},
+		{
+			name:    "removed without install",
+			entries: []JournalEntry{remove("/a.ini"), install("/b.so")},
+			want:    []string{"/b.so"},
+		},
+		{
+			name:    "unknown action",
+			entries: []JournalEntry{{Action: "upgrade", Files: []string{"/a.ini"}}},
+			want:    nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ActiveJournalFiles(test.entries); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"strings"
+	"time"
+)
+
+// KubernetesTargetPrefix marks a SERVICE-or-CONTAINER argument as Kubernetes pod, e.g. "pod/my-app-1234:php".
+const KubernetesTargetPrefix = "pod/"
+
+// defaultContainerAnnotation selects the container of a pod which kubectl uses if none is given.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// KubernetesOptions select the cluster and namespace; empty values mean "as configured in the kubeconfig".
+type KubernetesOptions struct {
+	Namespace string
+	Context   string
+}
+
+// KubernetesTarget is a validated, running container in a Kubernetes pod.
+type KubernetesTarget struct {
+	Namespace string
+	Pod       string
+	Container string
+	// ContainerID is the ID of the container in the container runtime of the node (without "containerd://" prefix).
+	ContainerID string
+	NodeName    string
+	Image       string
+}
+
+// IsKubernetesTarget returns true if the identifier has the form pod/NAME[:container].
+func IsKubernetesTarget(identifier string) bool {
+	return strings.HasPrefix(identifier, KubernetesTargetPrefix)
+}
+
+// ParseKubernetesTarget splits pod/NAME[:container] into the pod and (possibly empty) container name.
+func ParseKubernetesTarget(identifier string) (pod string, container string, err error) {
+	if !IsKubernetesTarget(identifier) {
+		return "", "", fmt.Errorf("%s is not in the form %sNAME[:container]", identifier, KubernetesTargetPrefix)
+	}
+	pod, container, _ = strings.Cut(strings.TrimPrefix(identifier, KubernetesTargetPrefix), ":")
+	if pod == "" {
+		return "", "", fmt.Errorf("%s does not contain a pod name", identifier)
+	}
+	return pod, container, nil
+}
+
+// KubernetesClient wraps the clientset together with the namespace to use.
+type KubernetesClient struct {
+	Clientset *kubernetes.Clientset
+	Namespace string
+	// Context is the kube context in use; needed for kubectl and VS Code.
+	Context string
+}
+
+// NewKubernetesClient loads the kubeconfig like kubectl does (KUBECONFIG, ~/.kube/config), with the given overrides.
+func NewKubernetesClient(options KubernetesOptions) (*KubernetesClient, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: options.Context},
+	)
+
+	namespace := options.Namespace
+	if namespace == "" {
+		var err error
+		namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine kubernetes namespace: %w", err)
+		}
+	}
+
+	contextName := options.Context
+	if contextName == "" {
+		rawConfig, err := clientConfig.RawConfig()
+		if err != nil {
+			return nil, fmt.Errorf("could not read kube config: %w", err)
+		}
+		contextName = rawConfig.CurrentContext
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not read kube config: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kubernetes client: %w", err)
+	}
+	return &KubernetesClient{Clientset: clientset, Namespace: namespace, Context: contextName}, nil
+}
+
+// ResolveTarget turns pod/NAME[:container] into a KubernetesTarget. If no container is given, the default container
+// of the pod is used (like kubectl exec).
+func (k *KubernetesClient) ResolveTarget(identifier string) (*KubernetesTarget, error) {
+	podName, containerName, err := ParseKubernetesTarget(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := k.Clientset.CoreV1().Pods(k.Namespace).Get(context.Background(), podName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, &TargetNotFoundError{Identifier: identifier, Err: fmt.Errorf("pod %s not found in namespace %s", podName, k.Namespace)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if containerName == "" {
+		containerName = pod.Annotations[defaultContainerAnnotation]
+	}
+	if containerName == "" && len(pod.Spec.Containers) > 0 {
+		containerName = pod.Spec.Containers[0].Name
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != containerName {
+			continue
+		}
+		if status.State.Running == nil || status.ContainerID == "" {
+			return nil, &TargetNotRunningError{Identifier: identifier, Name: podName + ":" + containerName}
+		}
+		// the ID is prefixed with the runtime, e.g. containerd://0123abc...
+		_, containerID, _ := strings.Cut(status.ContainerID, "://")
+		return &KubernetesTarget{
+			Namespace:   k.Namespace,
+			Pod:         podName,
+			Container:   containerName,
+			ContainerID: containerID,
+			NodeName:    pod.Spec.NodeName,
+			Image:       status.Image,
+		}, nil
+	}
+
+	var names []string
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	return nil, &TargetNotFoundError{Identifier: identifier, Err: fmt.Errorf("pod %s has no container %s (containers: %s)", podName, containerName, strings.Join(names, ", "))}
+}
+
+// NodeDebugPodName is the name of the debug pod for the given target (like CONTAINER_DEBUG for docker).
+func NodeDebugPodName(target *KubernetesTarget) string {
+	name := target.Pod + "-drydock-debug"
+	if len(name) > 63 {
+		// pod names are DNS labels, so they must not be longer than 63 characters.
+		name = name[len(name)-63:]
+		name = strings.TrimLeft(name, "-.")
+	}
+	return name
+}
+
+// CreateNodeDebugPod starts a privileged pod in the host PID namespace of the target's node (like
+// "docker run --privileged --pid=host"), and waits until it is running.
+func (k *KubernetesClient) CreateNodeDebugPod(target *KubernetesTarget, debugImage string) (string, error) {
+	name := NodeDebugPodName(target)
+	privileged := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: target.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "drydock",
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      target.NodeName,
+			HostPID:       true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			// the pod must run on the node of the target, no matter which taints it has.
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:    "debug",
+				Image:   debugImage,
+				Command: []string{"sleep", "infinity"},
+				Stdin:   true,
+				TTY:     true,
+				SecurityContext: &corev1.SecurityContext{
+					Privileged: &privileged,
+				},
+			}},
+		},
+	}
+
+	ctx := context.Background()
+	pods := k.Clientset.CoreV1().Pods(target.Namespace)
+	_, err := pods.Create(ctx, pod, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("debug pod %s already exists - is another drydock session running? Otherwise, delete it via kubectl", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not create debug pod %s: %w", name, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Minute)
+	for time.Now().Before(deadline) {
+		created, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return name, fmt.Errorf("could not get debug pod %s: %w", name, err)
+		}
+		switch created.Status.Phase {
+		case corev1.PodRunning:
+			return name, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return name, fmt.Errorf("debug pod %s terminated: %s", name, created.Status.Message)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return name, fmt.Errorf("debug pod %s did not start within 2 minutes", name)
+}
+
+// DeleteNodeDebugPod removes the debug pod again; a pod which is already gone is no error.
+func (k *KubernetesClient) DeleteNodeDebugPod(namespace, name string) error {
+	gracePeriod := int64(0)
+	err := k.Clientset.CoreV1().Pods(namespace).Delete(context.Background(), name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete debug pod %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNativeNsenterUnsupported is returned by RunInNamespaces on platforms without setns (i.e. everything but Linux).
+var ErrNativeNsenterUnsupported = errors.New("native nsenter mode is only supported on Linux hosts")
+
+// NsenterOptions describes a command which should be run inside the namespaces of a target container process,
+// without a privileged helper container (see RunInNamespaces).
+type NsenterOptions struct {
+	// Pid is the PID of the target container's main process, as seen from the host.
+	Pid int
+	// ContainerID is used to verify that Pid really belongs to the target container (and not e.g. to a process
+	// inside the Docker Desktop VM, which happens to have the same PID on the host).
+	ContainerID string
+	// Net enters the network namespace of the target as well.
+	Net bool
+	// Chroot enters the file system of the target (via /proc/PID/root); otherwise, the host file system is kept.
+	Chroot bool
+	// Env is the environment of the started command.
+	Env []string
+	// Command is the command to run, including its arguments. If not absolute, it is looked up in the PATH of Env
+	// (inside the target file system, if Chroot is set).
+	Command []string
+}
+
+// NsenterPermissionError is returned if the current user may not enter the namespaces of the target.
+type NsenterPermissionError struct {
+	Namespace string
+	Err       error
+}
+
+func (e *NsenterPermissionError) Error() string {
+	return fmt.Sprintf("entering the %s namespace is not permitted (root or CAP_SYS_ADMIN is needed): %s", e.Namespace, e.Err)
+}
+
+func (e *NsenterPermissionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,171 @@
+//go:build linux
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// RunInNamespaces runs options.Command in the namespaces of the target process (like
+// "nsenter --target PID --ipc --uts --pid [--net]"), and returns its exit code.
+//
+// The mount namespace cannot be entered from a multi-threaded Go process; so instead the command is chrooted into
+// /proc/PID/root, which shows the same file system (including all mounts of the container).
+func RunInNamespaces(options NsenterOptions) (int, error) {
+	if err := verifyContainerPid(options.Pid, options.ContainerID); err != nil {
+		return 0, err
+	}
+
+	namespaces := []struct {
+		name    string
+		nsType  int
+		enabled bool
+	}{
+		{"ipc", unix.CLONE_NEWIPC, true},
+		{"uts", unix.CLONE_NEWUTS, true},
+		{"net", unix.CLONE_NEWNET, options.Net},
+		// only affects child processes, which is exactly what we need.
+		{"pid", unix.CLONE_NEWPID, true},
+	}
+
+	type result struct {
+		exitCode int
+		err      error
+	}
+	done := make(chan result)
+
+	go func() {
+		// setns only changes the current OS thread. The thread is never unlocked, so that it is terminated together
+		// with this goroutine, instead of being reused by the Go runtime with the namespaces of the container.
+		runtime.LockOSThread()
+
+		for _, ns := range namespaces {
+			if !ns.enabled {
+				continue
+			}
+			if err := setns(options.Pid, ns.name, ns.nsType); err != nil {
+				done <- result{err: err}
+				return
+			}
+		}
+
+		exitCode, err := runInCurrentThread(options)
+		done <- result{exitCode, err}
+	}()
+
+	r := <-done
+	return r.exitCode, r.err
+}
+
+func setns(pid int, name string, nsType int) error {
+	nsFile := fmt.Sprintf("/proc/%d/ns/%s", pid, name)
+	fd, err := unix.Open(nsFile, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.EACCES) || errors.Is(err, unix.EPERM) {
+		return &NsenterPermissionError{Namespace: name, Err: err}
+	}
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", nsFile, err)
+	}
+	defer unix.Close(fd)
+
+	err = unix.Setns(fd, nsType)
+	if errors.Is(err, unix.EPERM) {
+		return &NsenterPermissionError{Namespace: name, Err: err}
+	}
+	if err != nil {
+		return fmt.Errorf("could not enter %s namespace of PID %d: %w", name, pid, err)
+	}
+	return nil
+}
+
+// runInCurrentThread starts the command; which inherits the namespaces of the current (locked) OS thread.
+func runInCurrentThread(options NsenterOptions) (int, error) {
+	root := "/"
+	if options.Chroot {
+		root = fmt.Sprintf("/proc/%d/root", options.Pid)
+	}
+
+	executable, err := lookPathIn(root, options.Command[0], options.Env)
+	if err != nil {
+		return 0, err
+	}
+
+	c := &exec.Cmd{
+		Path:   executable,
+		Args:   options.Command,
+		Env:    options.Env,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if options.Chroot {
+		c.Dir = "/"
+		c.SysProcAttr = &syscall.SysProcAttr{Chroot: root}
+	}
+
+	// Ctrl-C is sent to the whole foreground process group; only the started command should react to it.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	err = c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not run %s: %w", options.Command[0], err)
+	}
+	return 0, nil
+}
+
+// lookPathIn resolves file in the PATH of env, relative to root. The returned path is relative to root as well
+// (as it is executed after the chroot).
+func lookPathIn(root, file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	searchPath, ok := LookupEnv(env, "PATH")
+	if !ok {
+		searchPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	}
+	for _, dir := range filepath.SplitList(searchPath) {
+		candidate := path.Join(dir, file)
+		// Lstat, because absolute symlinks inside the container would be resolved against the host file system.
+		info, err := os.Lstat(filepath.Join(root, candidate))
+		if err == nil && (info.Mode()&os.ModeSymlink != 0 || (!info.IsDir() && info.Mode()&0111 != 0)) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in PATH %s of the container", file, searchPath)
+}
+
+// verifyContainerPid ensures that pid is a process of the given container on this host. With Docker Desktop (or a
+// remote docker host), the PID reported by docker belongs to a different machine.
+func verifyContainerPid(pid int, containerID string) error {
+	cgroup, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cgroup")
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("PID %d of the container does not exist on this host - is docker running in a VM (e.g. Docker Desktop)?", pid)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read cgroup of PID %d: %w", pid, err)
+	}
+	if containerID != "" && !strings.Contains(string(cgroup), containerID) {
+		return fmt.Errorf("PID %d does not belong to container %s on this host - is docker running in a VM (e.g. Docker Desktop)?", pid, containerID)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package util
+
+// RunInNamespaces is not available outside Linux; use the nsenter helper container instead.
+func RunInNamespaces(options NsenterOptions) (int, error) {
+	return 0, ErrNativeNsenterUnsupported
+}
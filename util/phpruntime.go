@@ -0,0 +1,146 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// The SAPIs (server APIs) serving PHP requests, as detected from the processes running in the container.
+const (
+	PhpSapiFpm        = "php-fpm"
+	PhpSapiApache     = "apache-mod_php"
+	PhpSapiFrankenPhp = "frankenphp"
+	PhpSapiRoadRunner = "roadrunner"
+	// PhpSapiSwoole is a Swoole (or OpenSwoole) server; detected by the loaded swoole.so.
+	PhpSapiSwoole = "swoole"
+	// PhpSapiCli means no long-running PHP server was found (e.g. a worker or cron container).
+	PhpSapiCli = "cli"
+)
+
+// PhpRuntime is what the PHP probe found out about PHP inside a container.
+type PhpRuntime struct {
+	// Binary is the PHP CLI used by drydock, e.g. /usr/local/bin/php
+	Binary string `json:"binary"`
+	// Binaries are all PHP related executables found in the container (php, php8.2, php-fpm, frankenphp, rr, ...)
+	Binaries []string `json:"binaries"`
+	// Version is the full PHP version, e.g. 8.2.12
+	Version      string `json:"version"`
+	Api          string `json:"api"`
+	Zts          bool   `json:"zts"`
+	ExtensionDir string `json:"extensionDir"`
+	// IniFile is the php.ini loaded by the CLI; empty if there is none.
+	IniFile string `json:"iniFile,omitempty"`
+	// IniScanDirs are the directories drydock writes its ini files to: the scan dir of the SAPI first, then the
+	// one of the CLI, if it differs (e.g. /etc/php/8.2/fpm/conf.d and /etc/php/8.2/cli/conf.d on Debian).
+	IniScanDirs []string `json:"iniScanDirs"`
+	// Sapi is one of the PhpSapi* constants.
+	Sapi string `json:"sapi"`
+	// SapiBinary is the executable of the running SAPI process, e.g. /usr/local/sbin/php-fpm
+	SapiBinary string `json:"sapiBinary,omitempty"`
+	// Supervisord is true if supervisord runs in the container (e.g. to manage workers).
+	Supervisord bool `json:"supervisord"`
+	// Arch is the machine architecture (uname -m), e.g. x86_64 or aarch64
+	Arch string `json:"arch"`
+	// Libc is glibc or musl (Alpine)
+	Libc string `json:"libc"`
+}
+
+// ParsePhpRuntime parses the key=value lines printed by the PHP probe in the container. binary= is repeated for
+// every executable found; the ini scan dirs are printed as sapi_ini_scan_dir= and cli_ini_scan_dir=.
+func ParsePhpRuntime(output string) (*PhpRuntime, error) {
+	values := map[string][]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "="); ok {
+			values[key] = append(values[key], strings.TrimSpace(value))
+		}
+	}
+	first := func(key string) string {
+		if len(values[key]) == 0 {
+			return ""
+		}
+		return values[key][0]
+	}
+
+	runtime := &PhpRuntime{
+		Binary:       first("php_binary"),
+		Binaries:     values["binary"],
+		Version:      first("version"),
+		Api:          first("php_api"),
+		Zts:          first("zts") == "1",
+		ExtensionDir: first("extension_dir"),
+		IniFile:      first("ini_file"),
+		Sapi:         first("sapi"),
+		SapiBinary:   first("sapi_binary"),
+		Supervisord:  first("supervisord") == "1",
+		Arch:         first("arch"),
+		Libc:         first("libc"),
+	}
+	for _, scanDir := range []string{first("sapi_ini_scan_dir"), first("cli_ini_scan_dir")} {
+		runtime.addIniScanDir(scanDir)
+	}
+	if runtime.Sapi == "" {
+		runtime.Sapi = PhpSapiCli
+	}
+
+	if runtime.Binary == "" {
+		return runtime, fmt.Errorf("no PHP binary found in the container")
+	}
+	if runtime.Version == "" || runtime.Api == "" || runtime.ExtensionDir == "" || runtime.Arch == "" {
+		return runtime, fmt.Errorf("could not run %s in the container", runtime.Binary)
+	}
+	return runtime, nil
+}
+
+// addIniScanDir adds the first directory of a scan dir setting (PHP_INI_SCAN_DIR may contain a ':' separated list),
+// unless it is already known.
+func (r *PhpRuntime) addIniScanDir(scanDir string) {
+	scanDir, _, _ = strings.Cut(scanDir, ":")
+	if scanDir == "" || scanDir == "(none)" {
+		return
+	}
+	for _, existing := range r.IniScanDirs {
+		if existing == scanDir {
+			return
+		}
+	}
+	r.IniScanDirs = append(r.IniScanDirs, scanDir)
+}
+
+// MinorVersion is major.minor of the PHP version, e.g. 8.2
+func (r *PhpRuntime) MinorVersion() string {
+	parts := strings.SplitN(r.Version, ".", 3)
+	if len(parts) < 2 {
+		return r.Version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// VersionAtLeast compares the PHP version with major.minor, e.g. VersionAtLeast(7, 2) for PHP 7.2 or newer.
+func (r *PhpRuntime) VersionAtLeast(major, minor int) bool {
+	var actualMajor, actualMinor int
+	fmt.Sscanf(r.Version, "%d.%d", &actualMajor, &actualMinor)
+	return actualMajor > major || (actualMajor == major && actualMinor >= minor)
+}
+
+// BuildKey identifies the PHP build for the extension cache.
+func (r *PhpRuntime) BuildKey() PhpBuildKey {
+	return PhpBuildKey{
+		PhpVersion: r.MinorVersion(),
+		PhpApi:     r.Api,
+		Zts:        r.Zts,
+		Arch:       r.Arch,
+		Libc:       r.Libc,
+	}
+}
+
+// IniFiles returns the paths of the given ini file (e.g. xdebug.ini) in all IniScanDirs.
+func (r *PhpRuntime) IniFiles(iniFile string) []string {
+	var files []string
+	for _, scanDir := range r.IniScanDirs {
+		files = append(files, path.Join(scanDir, iniFile))
+	}
+	return files
+}
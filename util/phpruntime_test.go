@@ -0,0 +1,181 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePhpRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    *PhpRuntime
+		wantErr string
+	}{
+		{
+			name: "php-fpm of the official image",
+			output: `php_binary=/usr/local/bin/php
+binary=/usr/local/bin/php
+binary=/usr/local/sbin/php-fpm
+version=8.2.12
+php_api=20220829
+zts=0
+extension_dir=/usr/local/lib/php/extensions/no-debug-non-zts-20220829
+ini_file=
+sapi=php-fpm
+sapi_binary=/usr/local/sbin/php-fpm
+sapi_ini_scan_dir=/usr/local/etc/php/conf.d
+cli_ini_scan_dir=/usr/local/etc/php/conf.d
+supervisord=0
+arch=x86_64
+libc=glibc
+`,
+			want: &PhpRuntime{
+				Binary:       "/usr/local/bin/php",
+				Binaries:     []string{"/usr/local/bin/php", "/usr/local/sbin/php-fpm"},
+				Version:      "8.2.12",
+				Api:          "20220829",
+				ExtensionDir: "/usr/local/lib/php/extensions/no-debug-non-zts-20220829",
+				IniScanDirs:  []string{"/usr/local/etc/php/conf.d"},
+				Sapi:         PhpSapiFpm,
+				SapiBinary:   "/usr/local/sbin/php-fpm",
+				Arch:         "x86_64",
+				Libc:         "glibc",
+			},
+		},
+		{
+			name: "Apache mod_php on Debian with separate scan dirs",
+			output: `php_binary=/usr/bin/php
+binary=/usr/bin/php8.1
+version=8.1.2
+php_api=20210902
+zts=0
+extension_dir=/usr/lib/php/20210902
+ini_file=/etc/php/8.1/cli/php.ini
+sapi=apache-mod_php
+sapi_binary=/usr/sbin/apache2
+sapi_ini_scan_dir=/etc/php/8.1/apache2/conf.d
+cli_ini_scan_dir=/etc/php/8.1/cli/conf.d
+supervisord=1
+arch=aarch64
+libc=glibc
+`,
+			want: &PhpRuntime{
+				Binary:       "/usr/bin/php",
+				Binaries:     []string{"/usr/bin/php8.1"},
+				Version:      "8.1.2",
+				Api:          "20210902",
+				ExtensionDir: "/usr/lib/php/20210902",
+				IniFile:      "/etc/php/8.1/cli/php.ini",
+				IniScanDirs:  []string{"/etc/php/8.1/apache2/conf.d", "/etc/php/8.1/cli/conf.d"},
+				Sapi:         PhpSapiApache,
+				SapiBinary:   "/usr/sbin/apache2",
+				Supervisord:  true,
+				Arch:         "aarch64",
+				Libc:         "glibc",
+			},
+		},
+		{
+			name: "CLI only, ZTS on Alpine",
+			output: `php_binary=/usr/local/bin/php
+version=8.3.0
+php_api=20230831
+zts=1
+extension_dir=/usr/local/lib/php/extensions/no-debug-zts-20230831
+sapi_ini_scan_dir=
+cli_ini_scan_dir=/usr/local/etc/php/conf.d:/app/php.d
+arch=x86_64
+libc=musl
+`,
+			want: &PhpRuntime{
+				Binary:       "/usr/local/bin/php",
+				Version:      "8.3.0",
+				Api:          "20230831",
+				Zts:          true,
+				ExtensionDir: "/usr/local/lib/php/extensions/no-debug-zts-20230831",
+				IniScanDirs:  []string{"/usr/local/etc/php/conf.d"},
+				Sapi:         PhpSapiCli,
+				Arch:         "x86_64",
+				Libc:         "musl",
+			},
+		},
+		{
+			name: "warnings and unknown lines are ignored",
+			output: `PHP Warning:  Module "redis" is already loaded in Unknown on line 0
+php_binary=/usr/local/bin/php
+PHP Warning:  Unknown: error_reporting=E_ALL in Unknown on line 0
+version=7.4.33
+php_api=20190902
+extension_dir=/usr/local/lib/php/extensions/no-debug-non-zts-20190902
+cli_ini_scan_dir=(none)
+arch=x86_64
+`,
+			want: &PhpRuntime{
+				Binary:       "/usr/local/bin/php",
+				Version:      "7.4.33",
+				Api:          "20190902",
+				ExtensionDir: "/usr/local/lib/php/extensions/no-debug-non-zts-20190902",
+				Sapi:         PhpSapiCli,
+				Arch:         "x86_64",
+			},
+		},
+		{
+			name:    "no PHP in the container",
+			output:  "arch=x86_64\nlibc=glibc\n",
+			wantErr: "no PHP binary found",
+		},
+		{
+			name:    "PHP binary which could not be run",
+			output:  "php_binary=/usr/local/bin/php\narch=x86_64\n",
+			wantErr: "could not run /usr/local/bin/php",
+		},
+		{
+			name:    "empty output",
+			output:  "",
+			wantErr: "no PHP binary found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParsePhpRuntime(test.output)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPhpRuntimeBuildKey(t *testing.T) {
+	runtime := &PhpRuntime{Version: "8.3.0RC1", Api: "20230831", Zts: true, Arch: "aarch64", Libc: "musl"}
+	if got := runtime.BuildKey().String(); got != "php8.3-api20230831-zts-aarch64-musl" {
+		t.Errorf("BuildKey() = %s", got)
+	}
+}
+
+func TestPhpRuntimeVersionAtLeast(t *testing.T) {
+	runtime := &PhpRuntime{Version: "8.2.12"}
+	for version, want := range map[[2]int]bool{{7, 4}: true, {8, 2}: true, {8, 3}: false, {9, 0}: false} {
+		if got := runtime.VersionAtLeast(version[0], version[1]); got != want {
+			t.Errorf("VersionAtLeast(%d, %d) = %v, want %v", version[0], version[1], got, want)
+		}
+	}
+}
+
+func TestPhpRuntimeIniFiles(t *testing.T) {
+	runtime := &PhpRuntime{IniScanDirs: []string{"/etc/php/8.1/fpm/conf.d", "/etc/php/8.1/cli/conf.d"}}
+	want := []string{"/etc/php/8.1/fpm/conf.d/drydock-xdebug.ini", "/etc/php/8.1/cli/conf.d/drydock-xdebug.ini"}
+	if got := runtime.IniFiles("drydock-xdebug.ini"); !reflect.DeepEqual(got, want) {
+		t.Errorf("IniFiles() = %v, want %v", got, want)
+	}
+}
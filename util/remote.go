@@ -0,0 +1,92 @@
+package util
+
+import (
+	"net"
+	"net/url"
+)
+
+// RemoteDockerHost describes a docker daemon which does not run on this machine (DOCKER_HOST=ssh://... or
+// tcp://..., or a docker context pointing there). Published ports are then reachable on Hostname, not on 127.0.0.1.
+type RemoteDockerHost struct {
+	// DockerHost is the endpoint in DOCKER_HOST notation, e.g. ssh://user@build-server
+	DockerHost string
+	// Hostname is the name (or IP) of the remote machine, to be used in URLs.
+	Hostname string
+
+	// SshUser and SshPort are set for ssh:// endpoints; if empty, the ssh config applies.
+	SshUser string
+	SshPort string
+	// Ssh is true if the daemon is reached via SSH; i.e. port forwards can be set up via the same connection.
+	Ssh bool
+}
+
+// ParseRemoteDockerHost returns the remote host for the given DOCKER_HOST style endpoint, or nil if the daemon runs
+// locally (unix socket, or tcp:// on localhost).
+func ParseRemoteDockerHost(host string) *RemoteDockerHost {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil
+	}
+
+	switch u.Scheme {
+	case "ssh":
+		remote := &RemoteDockerHost{
+			DockerHost: host,
+			Hostname:   u.Hostname(),
+			SshPort:    u.Port(),
+			Ssh:        true,
+		}
+		if u.User != nil {
+			remote.SshUser = u.User.Username()
+		}
+		return remote
+	case "tcp":
+		if isLoopbackHost(u.Hostname()) {
+			return nil
+		}
+		return &RemoteDockerHost{DockerHost: host, Hostname: u.Hostname()}
+	default:
+		return nil
+	}
+}
+
+// SshArgs returns the ssh arguments to connect to the remote host (port and destination); extraArgs are put in
+// front of the destination.
+func (r *RemoteDockerHost) SshArgs(extraArgs ...string) []string {
+	args := []string{}
+	if r.SshPort != "" {
+		args = append(args, "-p", r.SshPort)
+	}
+	args = append(args, extraArgs...)
+	return append(args, "--", r.SshDestination())
+}
+
+// SshDestination is [user@]host, as passed to ssh.
+func (r *RemoteDockerHost) SshDestination() string {
+	if r.SshUser != "" {
+		return r.SshUser + "@" + r.Hostname
+	}
+	return r.Hostname
+}
+
+// PublishedHost returns the host name under which a port published with the given host IP is reachable from this
+// machine; and false if it is only bound to the loopback interface of the remote host (so it needs a port forward).
+func (r *RemoteDockerHost) PublishedHost(hostIp string) (string, bool) {
+	if isLoopbackHost(hostIp) {
+		return "", false
+	}
+	return r.Hostname, true
+}
+
+// Remote returns where the daemon of this client runs, or nil if it is local.
+func (c *DockerClient) Remote() *RemoteDockerHost {
+	return ParseRemoteDockerHost(c.Host)
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
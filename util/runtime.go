@@ -0,0 +1,166 @@
+package util
+
+import (
+	"fmt"
+	"github.com/jonhadfield/findexec"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	RuntimeAuto   = "auto"
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// Runtime is the container engine the drydock commands operate on. All runtimes serve the Docker Engine API, so
+// containers (and thus PID, environment and ports of a Target) are resolved the same way for each of them; they only
+// differ in how the daemon is found and how the helper containers are started.
+type Runtime interface {
+	// Name is the name of the runtime, which is also the name of its CLI (e.g. "docker").
+	Name() string
+	// Executable returns the absolute path of the CLI, which is used to start (interactive) helper containers.
+	Executable() (string, error)
+	// HelperImage returns the image reference to pass to "run" for the given debug image.
+	HelperImage(image string) string
+	// Remote returns where the daemon runs, if it is not on this machine (or nil).
+	Remote() *RemoteDockerHost
+
+	InspectContainer(containerName string) (*ContainerInfo, error)
+	ListContainers(all bool, filters map[string][]string) ([]ContainerSummary, error)
+	PathExists(containerName, path string) (bool, error)
+	ReadFile(containerName, path string) ([]byte, error)
+	RemoveContainer(containerName string, force bool) error
+	ImageExists(image string) (bool, error)
+	PullImage(image string) error
+}
+
+// NewRuntime creates the runtime with the given name; "auto" (or "") detects it, see DetectRuntimeName.
+func NewRuntime(name string) (Runtime, error) {
+	if name == "" || name == RuntimeAuto {
+		name = DetectRuntimeName()
+	}
+
+	switch name {
+	case RuntimeDocker:
+		client, err := NewDockerClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return &DockerRuntime{client}, nil
+	case RuntimePodman:
+		client, err := NewPodmanClient(PodmanHostFromEnv())
+		if err != nil {
+			return nil, err
+		}
+		return &PodmanRuntime{client}, nil
+	default:
+		return nil, fmt.Errorf("unknown container runtime %s - must be %s, %s or %s", name, RuntimeAuto, RuntimeDocker, RuntimePodman)
+	}
+}
+
+// DetectRuntimeName returns the runtime to use if none is given: Docker, if it is configured or installed, and
+// Podman otherwise.
+func DetectRuntimeName() string {
+	if os.Getenv("DOCKER_HOST") != "" || os.Getenv("DOCKER_CONTEXT") != "" {
+		return RuntimeDocker
+	}
+	if os.Getenv("CONTAINER_HOST") != "" {
+		return RuntimePodman
+	}
+	if findexec.Find(RuntimeDocker, "") == "" && findexec.Find(RuntimePodman, "") != "" {
+		return RuntimePodman
+	}
+	return RuntimeDocker
+}
+
+// PodmanHostFromEnv returns the endpoint of the Docker compatible API of Podman: CONTAINER_HOST wins, then the
+// socket of the rootful service, then the socket of the rootless one.
+func PodmanHostFromEnv() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	const rootfulSocket = "/run/podman/podman.sock"
+	if _, err := os.Stat(rootfulSocket); err == nil {
+		return "unix://" + rootfulSocket
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return "unix://" + filepath.Join(runtimeDir, "podman", "podman.sock")
+	}
+	return "unix://" + rootfulSocket
+}
+
+// DockerRuntime talks to the Docker daemon; found like the docker CLI does (DOCKER_HOST, docker contexts).
+type DockerRuntime struct {
+	*DockerClient
+}
+
+func (r *DockerRuntime) Name() string {
+	return RuntimeDocker
+}
+
+func (r *DockerRuntime) Executable() (string, error) {
+	return findRuntimeExecutable(RuntimeDocker)
+}
+
+func (r *DockerRuntime) HelperImage(image string) string {
+	return image
+}
+
+func (r *DockerRuntime) PullImage(image string) error {
+	return pullImageWithCli(r, image)
+}
+
+// PodmanRuntime talks to the Docker compatible API of (rootful) Podman.
+type PodmanRuntime struct {
+	*DockerClient
+}
+
+func (r *PodmanRuntime) Name() string {
+	return RuntimePodman
+}
+
+func (r *PodmanRuntime) Executable() (string, error) {
+	return findRuntimeExecutable(RuntimePodman)
+}
+
+// HelperImage fully qualifies Docker Hub images; as Podman refuses to resolve short names like "nicolaka/netshoot"
+// without a TTY (short-name-mode "enforcing").
+func (r *PodmanRuntime) HelperImage(image string) string {
+	firstComponent, _, hasSlash := strings.Cut(image, "/")
+	if hasSlash && (strings.ContainsAny(firstComponent, ".:") || firstComponent == "localhost") {
+		return image
+	}
+	if !hasSlash {
+		return "docker.io/library/" + image
+	}
+	return "docker.io/" + image
+}
+
+func (r *PodmanRuntime) PullImage(image string) error {
+	return pullImageWithCli(r, image)
+}
+
+// pullImageWithCli pulls the image via "<runtime> pull" and not via the API, so that the registry credentials of the
+// CLI (docker config, credential helpers, podman auth.json) are used for private images.
+func pullImageWithCli(r Runtime, image string) error {
+	executable, err := r.Executable()
+	if err != nil {
+		return err
+	}
+	output, err := exec.Command(executable, "pull", image).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not pull %s: %w\n%s", image, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func findRuntimeExecutable(name string) (string, error) {
+	executable := findexec.Find(name, "")
+	if executable == "" {
+		return "", fmt.Errorf("%s CLI not found in PATH", name)
+	}
+	return executable, nil
+}
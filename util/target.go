@@ -0,0 +1,198 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	// composeContainerNumberLabel is the replica index of scaled services
+	composeContainerNumberLabel = "com.docker.compose.container-number"
+)
+
+// Target is a validated, running container which a drydock command operates on.
+type Target struct {
+	ID string
+	// Name of the container, without leading slash.
+	Name  string
+	Image string
+	// Pid of the container's init process, as seen from the docker host.
+	Pid   int
+	Env   []string
+	Ports []PortBinding
+
+	// ComposeProject and ComposeService are set if the container was started by docker compose.
+	ComposeProject string
+	ComposeService string
+	// MatchedComposeService is true if the user specified the compose service name (and not the container name).
+	MatchedComposeService bool
+}
+
+// HostPorts returns all ports of the container which are published on the docker host.
+func (t *Target) HostPorts() []int {
+	var result []int
+	for _, port := range t.Ports {
+		result = append(result, port.HostPort)
+	}
+	return result
+}
+
+// TargetNotFoundError is returned if neither a compose service nor a container with the given name exists.
+type TargetNotFoundError struct {
+	Identifier string
+	Err        error
+}
+
+func (e *TargetNotFoundError) Error() string {
+	return fmt.Sprintf("container or docker compose service %s not found: %s", e.Identifier, e.Err)
+}
+
+func (e *TargetNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// TargetNotRunningError is returned if the container exists, but is stopped.
+type TargetNotRunningError struct {
+	Identifier string
+	Name       string
+}
+
+func (e *TargetNotRunningError) Error() string {
+	return fmt.Sprintf("container %s not running", e.Name)
+}
+
+// TargetAmbiguousError is returned if the identifier matches more than one container (e.g. a scaled compose service).
+type TargetAmbiguousError struct {
+	Identifier string
+	// Candidates contains the container names (or IDs) which matched
+	Candidates []string
+}
+
+func (e *TargetAmbiguousError) Error() string {
+	return fmt.Sprintf("%s matches %d containers: %s", e.Identifier, len(e.Candidates), strings.Join(e.Candidates, ", "))
+}
+
+// TargetResolver turns the SERVICE-or-CONTAINER argument of the drydock commands into a Target.
+type TargetResolver struct {
+	Runtime Runtime
+	Compose ComposeOptions
+	// Index selects the replica of a scaled compose service (like "docker compose exec --index"). 0 means unset.
+	Index int
+	// Pick is called if a compose service has multiple running replicas and no Index is given. If nil, a
+	// TargetAmbiguousError is returned instead.
+	Pick func(identifier string, candidates []ContainerSummary) (*ContainerSummary, error)
+}
+
+func NewTargetResolver(runtime Runtime) *TargetResolver {
+	return &TargetResolver{Runtime: runtime}
+}
+
+// Resolve looks up the identifier as docker compose service first, and falls back to treating it as container
+// name or ID.
+func (r *TargetResolver) Resolve(identifier string) (*Target, error) {
+	containerIdentifier := identifier
+	matchedComposeService := false
+
+	candidates, err := r.findComposeServiceContainers(identifier)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > 0 {
+		selected, err := r.selectReplica(identifier, candidates)
+		if err != nil {
+			return nil, err
+		}
+		containerIdentifier = selected.ID
+		matchedComposeService = true
+	}
+
+	info, err := r.Runtime.InspectContainer(containerIdentifier)
+	if errors.Is(err, ErrNoSuchContainer) {
+		return nil, &TargetNotFoundError{Identifier: identifier, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Running || info.Pid == 0 {
+		return nil, &TargetNotRunningError{Identifier: identifier, Name: info.Name}
+	}
+
+	return &Target{
+		ID:                    info.ID,
+		Name:                  info.Name,
+		Image:                 info.Image,
+		Pid:                   info.Pid,
+		Env:                   info.Env,
+		Ports:                 info.Ports,
+		ComposeProject:        info.Labels[composeProjectLabel],
+		ComposeService:        info.Labels[composeServiceLabel],
+		MatchedComposeService: matchedComposeService,
+	}, nil
+}
+
+// findComposeServiceContainers finds the running containers of the compose service via their labels. This does
+// not need the compose binary, and works regardless of the directory the stack was started from. If nothing is
+// found (e.g. because the project is renamed via "name:" in the compose file), we fall back to asking compose.
+func (r *TargetResolver) findComposeServiceContainers(service string) ([]ContainerSummary, error) {
+	candidates, err := r.Runtime.ListContainers(false, map[string][]string{
+		"label": {
+			composeProjectLabel + "=" + r.Compose.ProjectNameOrDefault(),
+			composeServiceLabel + "=" + service,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	containerIds, err := ComposeServiceContainerIds(r.Runtime.Name(), r.Compose, service)
+	if err != nil || len(containerIds) == 0 {
+		// no compose available, or no such service; so the identifier is a container name.
+		return nil, nil
+	}
+	return r.Runtime.ListContainers(false, map[string][]string{"id": containerIds})
+}
+
+// selectReplica picks one container of a (possibly scaled) compose service.
+func (r *TargetResolver) selectReplica(identifier string, candidates []ContainerSummary) (*ContainerSummary, error) {
+	sort.Slice(candidates, func(i, j int) bool {
+		return replicaNumber(candidates[i]) < replicaNumber(candidates[j])
+	})
+
+	if r.Index > 0 {
+		for i := range candidates {
+			if replicaNumber(candidates[i]) == r.Index {
+				return &candidates[i], nil
+			}
+		}
+		return nil, &TargetNotFoundError{Identifier: identifier, Err: fmt.Errorf("replica with index %d not running", r.Index)}
+	}
+
+	if len(candidates) == 1 {
+		return &candidates[0], nil
+	}
+
+	if r.Pick != nil {
+		return r.Pick(identifier, candidates)
+	}
+
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate.Name)
+	}
+	return nil, &TargetAmbiguousError{Identifier: identifier, Candidates: names}
+}
+
+// replicaNumber returns the index of the container within its compose service (1 based).
+func replicaNumber(container ContainerSummary) int {
+	number, _ := strconv.Atoi(container.Labels[composeContainerNumberLabel])
+	return number
+}
@@ -0,0 +1,186 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeRuntime is a Runtime with a fixed set of containers; only lookups are supported.
+type fakeRuntime struct {
+	containers []ContainerInfo
+	// files are the contents of files by path, the same for all containers
+	files map[string]string
+}
+
+// fakeRuntimeName has no compose command, so that the resolver does not fall back to running compose.
+const fakeRuntimeName = "fake"
+
+func newFakeRuntime(containers ...ContainerInfo) *fakeRuntime {
+	composeCommandsLock.Lock()
+	composeCommands[fakeRuntimeName] = detectedComposeCommand{err: errors.New("no compose for the fake runtime")}
+	composeCommandsLock.Unlock()
+	return &fakeRuntime{containers: containers}
+}
+
+func (r *fakeRuntime) Name() string                       { return fakeRuntimeName }
+func (r *fakeRuntime) Executable() (string, error)        { return "", errors.New("not supported") }
+func (r *fakeRuntime) HelperImage(image string) string    { return image }
+func (r *fakeRuntime) Remote() *RemoteDockerHost          { return nil }
+func (r *fakeRuntime) ImageExists(string) (bool, error)   { return false, errors.New("not supported") }
+func (r *fakeRuntime) PullImage(string) error             { return errors.New("not supported") }
+func (r *fakeRuntime) RemoveContainer(string, bool) error { return errors.New("not supported") }
+func (r *fakeRuntime) PathExists(string, string) (bool, error) {
+	return false, errors.New("not supported")
+}
+func (r *fakeRuntime) ReadFile(containerName string, path string) ([]byte, error) {
+	content, ok := r.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s in %s: %w", path, containerName, os.ErrNotExist)
+	}
+	return []byte(content), nil
+}
+
+func (r *fakeRuntime) InspectContainer(containerName string) (*ContainerInfo, error) {
+	for i, container := range r.containers {
+		if container.Name == containerName || container.ID == containerName {
+			return &r.containers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSuchContainer, containerName)
+}
+
+// ListContainers supports the label filter (all labels must match).
+func (r *fakeRuntime) ListContainers(all bool, filters map[string][]string) ([]ContainerSummary, error) {
+	var result []ContainerSummary
+	for _, container := range r.containers {
+		if !all && !container.Running {
+			continue
+		}
+		matches := true
+		for _, label := range filters["label"] {
+			key, value, _ := strings.Cut(label, "=")
+			if container.Labels[key] != value {
+				matches = false
+			}
+		}
+		if matches {
+			result = append(result, ContainerSummary{ID: container.ID, Name: container.Name, Image: container.Image, Labels: container.Labels})
+		}
+	}
+	return result, nil
+}
+
+// fakeComposeContainer is a running replica of a compose service of the project "myproject".
+func fakeComposeContainer(service string, replica int) ContainerInfo {
+	return ContainerInfo{
+		ID:      fmt.Sprintf("%s%d-id", service, replica),
+		Name:    fmt.Sprintf("myproject-%s-%d", service, replica),
+		Image:   "myproject/" + service,
+		Running: true,
+		Pid:     1000 + replica,
+		Labels: map[string]string{
+			composeProjectLabel:         "myproject",
+			composeServiceLabel:         service,
+			composeContainerNumberLabel: fmt.Sprint(replica),
+		},
+	}
+}
+
+func TestTargetResolverResolve(t *testing.T) {
+	runtime := newFakeRuntime(
+		fakeComposeContainer("neos", 1),
+		fakeComposeContainer("worker", 1),
+		fakeComposeContainer("worker", 2),
+		ContainerInfo{ID: "standalone-id", Name: "standalone", Running: true, Pid: 2000},
+		ContainerInfo{ID: "stopped-id", Name: "stopped", Running: false},
+	)
+
+	tests := []struct {
+		name        string
+		identifier  string
+		index       int
+		wantName    string
+		wantService bool
+		wantErr     any
+	}{
+		{name: "compose service", identifier: "neos", wantName: "myproject-neos-1", wantService: true},
+		{name: "container name of a compose service", identifier: "myproject-neos-1", wantName: "myproject-neos-1"},
+		{name: "container name", identifier: "standalone", wantName: "standalone"},
+		{name: "container ID", identifier: "standalone-id", wantName: "standalone"},
+		{name: "unknown", identifier: "unknown", wantErr: &TargetNotFoundError{}},
+		{name: "stopped container", identifier: "stopped", wantErr: &TargetNotRunningError{}},
+		{name: "scaled service without index", identifier: "worker", wantErr: &TargetAmbiguousError{}},
+		{name: "scaled service with index", identifier: "worker", index: 2, wantName: "myproject-worker-2", wantService: true},
+		{name: "index out of range", identifier: "worker", index: 3, wantErr: &TargetNotFoundError{}},
+		{name: "index of a single replica", identifier: "neos", index: 1, wantName: "myproject-neos-1", wantService: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolver := NewTargetResolver(runtime)
+			resolver.Compose = ComposeOptions{ProjectName: "myproject"}
+			resolver.Index = test.index
+
+			target, err := resolver.Resolve(test.identifier)
+			switch test.wantErr.(type) {
+			case *TargetNotFoundError:
+				var notFound *TargetNotFoundError
+				if !errors.As(err, &notFound) || notFound.Identifier != test.identifier {
+					t.Fatalf("expected TargetNotFoundError for %s, got %v", test.identifier, err)
+				}
+				return
+			case *TargetNotRunningError:
+				var notRunning *TargetNotRunningError
+				if !errors.As(err, &notRunning) || notRunning.Name != test.identifier {
+					t.Fatalf("expected TargetNotRunningError for %s, got %v", test.identifier, err)
+				}
+				return
+			case *TargetAmbiguousError:
+				var ambiguous *TargetAmbiguousError
+				if !errors.As(err, &ambiguous) {
+					t.Fatalf("expected TargetAmbiguousError, got %v", err)
+				}
+				if want := "myproject-worker-1,myproject-worker-2"; strings.Join(ambiguous.Candidates, ",") != want {
+					t.Errorf("candidates = %v, want %s", ambiguous.Candidates, want)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if target.Name != test.wantName || target.MatchedComposeService != test.wantService {
+				t.Errorf("got %s (compose service: %v), want %s (compose service: %v)", target.Name, target.MatchedComposeService, test.wantName, test.wantService)
+			}
+		})
+	}
+}
+
+func TestTargetResolverPick(t *testing.T) {
+	runtime := newFakeRuntime(fakeComposeContainer("worker", 2), fakeComposeContainer("worker", 1))
+	resolver := NewTargetResolver(runtime)
+	resolver.Compose = ComposeOptions{ProjectName: "myproject"}
+
+	var offered []string
+	resolver.Pick = func(identifier string, candidates []ContainerSummary) (*ContainerSummary, error) {
+		for _, candidate := range candidates {
+			offered = append(offered, candidate.Name)
+		}
+		return &candidates[1], nil
+	}
+
+	target, err := resolver.Resolve("worker")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the replicas are offered sorted by their index
+	if want := "myproject-worker-1,myproject-worker-2"; strings.Join(offered, ",") != want {
+		t.Errorf("offered %v, want %s", offered, want)
+	}
+	if target.Name != "myproject-worker-2" {
+		t.Errorf("got %s, want the picked myproject-worker-2", target.Name)
+	}
+}
@@ -0,0 +1,258 @@
+package util
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XdebugTraceFunction are the aggregated calls of one function in a trace.
+type XdebugTraceFunction struct {
+	Name  string
+	Calls int
+	// Inclusive is the time spent in the function including its callees; for recursive functions, the time of
+	// the recursive calls is counted multiple times.
+	Inclusive time.Duration
+	Self      time.Duration
+}
+
+// XdebugTraceNode is a node of the call tree, where all calls of the same function from the same path are
+// aggregated (so that a loop calling a function 10 000 times is one node with Calls=10000).
+type XdebugTraceNode struct {
+	XdebugTraceFunction
+	Children []*XdebugTraceNode
+
+	childrenByName map[string]*XdebugTraceNode
+}
+
+// XdebugTrace is a function trace written by Xdebug with xdebug.mode=trace and xdebug.trace_format=1.
+type XdebugTrace struct {
+	Functions map[string]*XdebugTraceFunction
+	// Root is an artificial node; its children are the top level calls (usually {main}).
+	Root *XdebugTraceNode
+}
+
+// ReadXdebugTraceFile parses the given trace file (.xt, or .xt.gz if Xdebug compressed it).
+func ReadXdebugTraceFile(path string) (*XdebugTrace, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress %s: %w", path, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	trace, err := ParseXdebugTrace(reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return trace, nil
+}
+
+// xdebugTraceFrame is a function call which has not returned yet.
+type xdebugTraceFrame struct {
+	functionNumber string
+	node           *XdebugTraceNode
+	start          time.Duration
+	childTime      time.Duration
+}
+
+// ParseXdebugTrace parses the "computerized" trace format (https://xdebug.org/docs/trace#trace_format): tab
+// separated lines with level, function number, 0 (entry) / 1 (exit) / R (return value), time index, and for
+// entries the memory usage and function name.
+func ParseXdebugTrace(reader io.Reader) (*XdebugTrace, error) {
+	trace := &XdebugTrace{
+		Functions: map[string]*XdebugTraceFunction{},
+		Root:      newXdebugTraceNode(""),
+	}
+	var stack []*xdebugTraceFrame
+	sawHeader := false
+	// lastTime is the last time index seen; frames which are still open at the end are closed with it.
+	var lastTime time.Duration
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "File format:") {
+			sawHeader = true
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 {
+			// headers and TRACE START/END
+			continue
+		}
+		if fields[0] == "" {
+			// the summary line at the end, with the time index when the script ended
+			if end, err := parseTraceTimeIndex(fields[3]); err == nil {
+				lastTime = end
+			}
+			continue
+		}
+
+		switch fields[2] {
+		case "0":
+			if len(fields) < 6 {
+				return nil, fmt.Errorf("invalid entry line %q", line)
+			}
+			start, err := parseTraceTimeIndex(fields[3])
+			if err != nil {
+				return nil, err
+			}
+			lastTime = start
+			parent := trace.Root
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1].node
+			}
+			stack = append(stack, &xdebugTraceFrame{
+				functionNumber: fields[1],
+				node:           parent.child(fields[5]),
+				start:          start,
+			})
+		case "1":
+			end, err := parseTraceTimeIndex(fields[3])
+			if err != nil {
+				return nil, err
+			}
+			lastTime = end
+			if !slices.ContainsFunc(stack, func(frame *xdebugTraceFrame) bool { return frame.functionNumber == fields[1] }) {
+				// an exit without entry (e.g. the trace was started within the function): closing the other frames
+				// here would corrupt their times.
+				continue
+			}
+			// unwind to the matching entry; frames without exit line (e.g. exit() in PHP) are closed as well.
+			for len(stack) > 0 {
+				frame := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				trace.closeFrame(frame, end, stack)
+				if frame.functionNumber == fields[1] {
+					break
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !sawHeader {
+		return nil, fmt.Errorf("not an Xdebug trace file in computerized format (xdebug.trace_format=1)")
+	}
+	// frames without exit line at the end of the trace (e.g. exit() in PHP, or a truncated trace file)
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		trace.closeFrame(frame, max(lastTime, frame.start), stack)
+	}
+	return trace, nil
+}
+
+func (t *XdebugTrace) closeFrame(frame *xdebugTraceFrame, end time.Duration, remaining []*xdebugTraceFrame) {
+	duration := end - frame.start
+	self := duration - frame.childTime
+
+	frame.node.Calls++
+	frame.node.Inclusive += duration
+	frame.node.Self += self
+
+	function, ok := t.Functions[frame.node.Name]
+	if !ok {
+		function = &XdebugTraceFunction{Name: frame.node.Name}
+		t.Functions[frame.node.Name] = function
+	}
+	function.Calls++
+	function.Inclusive += duration
+	function.Self += self
+
+	if len(remaining) > 0 {
+		remaining[len(remaining)-1].childTime += duration
+	}
+}
+
+// TopFunctions returns the n functions (matching the name prefix, if not empty) with the most calls.
+func (t *XdebugTrace) TopFunctions(n int, prefix string) []*XdebugTraceFunction {
+	var functions []*XdebugTraceFunction
+	for _, f := range t.Functions {
+		if strings.HasPrefix(f.Name, prefix) {
+			functions = append(functions, f)
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Calls != functions[j].Calls {
+			return functions[i].Calls > functions[j].Calls
+		}
+		if functions[i].Inclusive != functions[j].Inclusive {
+			return functions[i].Inclusive > functions[j].Inclusive
+		}
+		return functions[i].Name < functions[j].Name
+	})
+	if n > 0 && len(functions) > n {
+		functions = functions[:n]
+	}
+	return functions
+}
+
+// Filter returns a copy of the call tree which only contains functions matching the name prefix (e.g. "Neos\\");
+// the callees of other functions are attached to their nearest matching caller.
+func (n *XdebugTraceNode) Filter(prefix string) *XdebugTraceNode {
+	result := newXdebugTraceNode(n.Name)
+	result.XdebugTraceFunction = n.XdebugTraceFunction
+	result.addFilteredChildren(n.Children, prefix)
+	return result
+}
+
+func (n *XdebugTraceNode) addFilteredChildren(children []*XdebugTraceNode, prefix string) {
+	for _, child := range children {
+		if !strings.HasPrefix(child.Name, prefix) {
+			n.addFilteredChildren(child.Children, prefix)
+			continue
+		}
+		target := n.child(child.Name)
+		target.Calls += child.Calls
+		target.Inclusive += child.Inclusive
+		target.Self += child.Self
+		target.addFilteredChildren(child.Children, prefix)
+	}
+}
+
+func newXdebugTraceNode(name string) *XdebugTraceNode {
+	return &XdebugTraceNode{
+		XdebugTraceFunction: XdebugTraceFunction{Name: name},
+		childrenByName:      map[string]*XdebugTraceNode{},
+	}
+}
+
+// child returns the aggregated child node for the given function, creating it on the first call.
+func (n *XdebugTraceNode) child(name string) *XdebugTraceNode {
+	if child, ok := n.childrenByName[name]; ok {
+		return child
+	}
+	child := newXdebugTraceNode(name)
+	n.childrenByName[name] = child
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// parseTraceTimeIndex parses the time index column, which is in seconds since the start of the trace.
+func parseTraceTimeIndex(value string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time index %q: %w", value, err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,281 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xdebugTraceLines joins the lines of a trace fixture; the columns are given separated by "|" for readability.
+func xdebugTraceLines(lines ...string) string {
+	return strings.ReplaceAll(strings.Join(lines, "\n"), "|", "\t") + "\n"
+}
+
+// xdebugTraceHeader is the header Xdebug writes with xdebug.trace_format=1.
+var xdebugTraceHeader = []string{
+	"Version: 3.3.1",
+	"File format: 4",
+	"TRACE START [2024-01-15 10:00:00.000000]",
+}
+
+func TestParseXdebugTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []XdebugTraceFunction
+		wantErr string
+	}{
+		{
+			name: "nested calls",
+			// {main} calls foo() twice, and foo() calls bar() once.
+			input: xdebugTraceLines(append(xdebugTraceHeader,
+				"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+				"2|1|0|0.250000|400100|foo|1||/app/index.php|3|0",
+				"3|2|0|0.375000|400200|bar|1||/app/index.php|10|0",
+				"3|2|1|0.500000|400200",
+				"2|1|1|0.750000|400100",
+				"2|3|0|1.000000|400100|foo|1||/app/index.php|4|0",
+				"2|3|1|1.250000|400100",
+				"1|0|1|2.000000|400000",
+				"|||2.125000|300000",
+				"TRACE END   [2024-01-15 10:00:02.125000]",
+			)...),
+			want: []XdebugTraceFunction{
+				{Name: "{main}", Calls: 1, Inclusive: 2 * time.Second, Self: 1250 * time.Millisecond},
+				{Name: "foo", Calls: 2, Inclusive: 750 * time.Millisecond, Self: 625 * time.Millisecond},
+				{Name: "bar", Calls: 1, Inclusive: 125 * time.Millisecond, Self: 125 * time.Millisecond},
+			},
+		},
+		{
+			name: "return values are ignored",
+			input: xdebugTraceLines(append(xdebugTraceHeader,
+				"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+				"2|1|0|0.250000|400100|foo|1||/app/index.php|3|0",
+				"2|1|1|0.500000|400100",
+				"2|1|R||'result'",
+				"1|0|1|1.000000|400000",
+			)...),
+			want: []XdebugTraceFunction{
+				{Name: "{main}", Calls: 1, Inclusive: time.Second, Self: 750 * time.Millisecond},
+				{Name: "foo", Calls: 1, Inclusive: 250 * time.Millisecond, Self: 250 * time.Millisecond},
+			},
+		},
+		{
+			name: "frames without exit line are closed with their caller",
+			// exit() in foo(): there is no exit line for foo
+			input: xdebugTraceLines(append(xdebugTraceHeader,
+				"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+				"2|1|0|0.250000|400100|foo|1||/app/index.php|3|0",
+				"1|0|1|1.000000|400000",
+			)...),
+			want: []XdebugTraceFunction{
+				{Name: "{main}", Calls: 1, Inclusive: time.Second, Self: 250 * time.Millisecond},
+				{Name: "foo", Calls: 1, Inclusive: 750 * time.Millisecond, Self: 750 * time.Millisecond},
+			},
+		},
+		{
+			name: "exit line of a function which is not on the stack is ignored",
+			input: xdebugTraceLines(append(xdebugTraceHeader,
+				"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+				"2|1|0|0.250000|400100|foo|1||/app/index.php|3|0",
+				"2|7|1|0.500000|400100",
+				"2|1|1|0.750000|400100",
+				"1|0|1|1.000000|400000",
+			)...),
+			want: []XdebugTraceFunction{
+				{Name: "{main}", Calls: 1, Inclusive: time.Second, Self: 500 * time.Millisecond},
+				{Name: "foo", Calls: 1, Inclusive: 500 * time.Millisecond, Self: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "open frames are closed at the end time of the summary line",
+			// exit() in foo(): neither foo nor {main} have an exit line
+			input: xdebugTraceLines(append(xdebugTraceHeader,
+				"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+				"2|1|0|0.250000|400100|foo|1||/app/index.php|3|0",
+				"|||1.000000|300000",
+				"TRACE END   [2024-01-15 10:00:01.000000]",
+			)...),
+			want: []XdebugTraceFunction{
+				{Name: "{main}", Calls: 1, Inclusive: time.Second, Self: 250 * time.Millisecond},
+				{Name: "foo", Calls: 1, Inclusive: 750 * time.Millisecond, Self: 750 * time.Millisecond},
+			},
+		},
+		{
+			name: "open frames of a truncated trace are closed at the last time index",
+			input: xdebugTraceLines(append(xdebugTraceHeader,
+				"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+				"2|1|0|0.250000|400100|foo|1||/app/index.php|3|0",
+				"3|2|0|0.500000|400200|bar|1||/app/index.php|10|0",
+			)...),
+			want: []XdebugTraceFunction{
+				{Name: "{main}", Calls: 1, Inclusive: 500 * time.Millisecond, Self: 250 * time.Millisecond},
+				{Name: "foo", Calls: 1, Inclusive: 250 * time.Millisecond, Self: 250 * time.Millisecond},
+				{Name: "bar", Calls: 1, Inclusive: 0, Self: 0},
+			},
+		},
+		{
+			name:    "no trace header",
+			input:   xdebugTraceLines("1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0"),
+			wantErr: "not an Xdebug trace file",
+		},
+		{
+			name:    "entry line without function name",
+			input:   xdebugTraceLines(append(xdebugTraceHeader, "1|0|0|0.000000|400000")...),
+			wantErr: "invalid entry line",
+		},
+		{
+			name:    "invalid time index",
+			input:   xdebugTraceLines(append(xdebugTraceHeader, "1|0|0|now|400000|{main}|1||/app/index.php|0|0")...),
+			wantErr: "invalid time index",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trace, err := ParseXdebugTrace(strings.NewReader(test.input))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(trace.Functions) != len(test.want) {
+				t.Errorf("got %d functions, want %d", len(trace.Functions), len(test.want))
+			}
+			for _, want := range test.want {
+				got, ok := trace.Functions[want.Name]
+				if !ok {
+					t.Errorf("function %s not found", want.Name)
+					continue
+				}
+				if *got != want {
+					t.Errorf("function %s = %+v, want %+v", want.Name, *got, want)
+				}
+			}
+		})
+	}
+}
+
+// formatXdebugTraceTree renders the call tree as "name(calls)" lines, indented by depth.
+func formatXdebugTraceTree(node *XdebugTraceNode, depth int, result *[]string) {
+	for _, child := range node.Children {
+		*result = append(*result, strings.Repeat("  ", depth)+child.Name+"("+strconv.Itoa(child.Calls)+")")
+		formatXdebugTraceTree(child, depth+1, result)
+	}
+}
+
+func TestXdebugTraceCallTree(t *testing.T) {
+	input := xdebugTraceLines(append(xdebugTraceHeader,
+		"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+		"2|1|0|0.125000|400100|Neos\\Flow\\Core\\Bootstrap->run|1||/app/index.php|3|0",
+		"3|2|0|0.250000|400200|strlen|0||/app/Bootstrap.php|10|1",
+		"3|2|1|0.375000|400200",
+		"3|3|0|0.500000|400200|Neos\\Flow\\Http\\RequestHandler->handle|1||/app/Bootstrap.php|11|0",
+		"4|4|0|0.625000|400300|strlen|0||/app/RequestHandler.php|20|1",
+		"4|4|1|0.750000|400300",
+		"3|3|1|0.875000|400200",
+		"3|5|0|1.000000|400200|strlen|0||/app/Bootstrap.php|12|1",
+		"3|5|1|1.125000|400200",
+		"2|1|1|1.250000|400100",
+		"1|0|1|1.500000|400000",
+	)...)
+	trace, err := ParseXdebugTrace(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{
+			name:   "calls of the same function from the same caller are aggregated",
+			prefix: "",
+			want: []string{
+				"{main}(1)",
+				"  Neos\\Flow\\Core\\Bootstrap->run(1)",
+				"    strlen(2)",
+				"    Neos\\Flow\\Http\\RequestHandler->handle(1)",
+				"      strlen(1)",
+			},
+		},
+		{
+			name:   "filtered by prefix",
+			prefix: "Neos\\",
+			want: []string{
+				"Neos\\Flow\\Core\\Bootstrap->run(1)",
+				"  Neos\\Flow\\Http\\RequestHandler->handle(1)",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			formatXdebugTraceTree(trace.Root.Filter(test.prefix), 0, &got)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("call tree =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+
+	top := trace.TopFunctions(1, "")
+	if len(top) != 1 || top[0].Name != "strlen" || top[0].Calls != 3 {
+		t.Errorf("TopFunctions(1) = %+v, want strlen with 3 calls", top)
+	}
+}
+
+func TestReadXdebugTraceFile(t *testing.T) {
+	trace := xdebugTraceLines(append(xdebugTraceHeader,
+		"1|0|0|0.000000|400000|{main}|1||/app/index.php|0|0",
+		"1|0|1|0.500000|400000",
+	)...)
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write([]byte(trace))
+	gzipWriter.Close()
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		wantErr string
+	}{
+		{name: "plain", file: "trace.1.xt", content: []byte(trace)},
+		{name: "gzip compressed", file: "trace.1.xt.gz", content: gzipped.Bytes()},
+		{name: "not gzip compressed", file: "trace.1.xt.gz", content: []byte(trace), wantErr: "could not decompress"},
+		{name: "truncated gzip", file: "trace.1.xt.gz", content: gzipped.Bytes()[:gzipped.Len()/2], wantErr: "could not parse"},
+		{name: "not a trace", file: "trace.1.xt", content: []byte("<?php echo 'hello';\n"), wantErr: "not an Xdebug trace file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), test.file)
+			if err := os.WriteFile(file, test.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadXdebugTraceFile(file)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if main := got.Functions["{main}"]; main == nil || main.Inclusive != 500*time.Millisecond {
+				t.Errorf("{main} = %+v, want 500ms inclusive", main)
+			}
+		})
+	}
+}